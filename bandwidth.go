@@ -0,0 +1,173 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	. "github.com/anacrolix/generics"
+	"golang.org/x/time/rate"
+)
+
+// Upload and download rate limits shared by the Torrents in the group. These stack with the
+// Client-wide limiters in ClientConfig, and each Torrent's own limits. See Client.BandwidthGroup.
+type BandwidthGroup struct {
+	name            string
+	uploadLimiter   *rate.Limiter
+	downloadLimiter *rate.Limiter
+}
+
+func (me *BandwidthGroup) Name() string {
+	return me.name
+}
+
+// Sets the rate in bytes per second, and the burst in bytes, that Torrents in the group may upload
+// at. rate.Inf removes the limit. The burst should be at least the chunk size peers request.
+func (me *BandwidthGroup) SetUploadRateLimit(limit rate.Limit, burst int) error {
+	return setRateLimit(me.uploadLimiter, limit, burst)
+}
+
+// Sets the rate in bytes per second, and the burst in bytes, that Torrents in the group may
+// download at. rate.Inf removes the limit.
+func (me *BandwidthGroup) SetDownloadRateLimit(limit rate.Limit, burst int) error {
+	return setRateLimit(me.downloadLimiter, limit, burst)
+}
+
+// Returns the named BandwidthGroup, creating it without limits if it doesn't exist.
+func (cl *Client) BandwidthGroup(name string) *BandwidthGroup {
+	cl.lock()
+	defer cl.unlock()
+	bg, ok := cl.bandwidthGroups[name]
+	if !ok {
+		bg = &BandwidthGroup{
+			name:            name,
+			uploadLimiter:   rate.NewLimiter(rate.Inf, 0),
+			downloadLimiter: rate.NewLimiter(rate.Inf, 0),
+		}
+		if cl.bandwidthGroups == nil {
+			cl.bandwidthGroups = make(map[string]*BandwidthGroup)
+		}
+		cl.bandwidthGroups[name] = bg
+	}
+	return bg
+}
+
+// Adds the Torrent to a BandwidthGroup, replacing any previous group. nil removes the Torrent from
+// its group.
+func (t *Torrent) SetBandwidthGroup(bg *BandwidthGroup) {
+	t.bandwidthGroup.Store(bg)
+}
+
+// Sets the rate in bytes per second, and the burst in bytes, that the Torrent may upload at. This
+// stacks with ClientConfig.UploadRateLimiter. rate.Inf removes the limit. The burst should be at
+// least the chunk size peers request.
+func (t *Torrent) SetUploadRateLimit(limit rate.Limit, burst int) error {
+	return setRateLimit(t.uploadRateLimiter, limit, burst)
+}
+
+// Sets the rate in bytes per second, and the burst in bytes, that the Torrent may download at. This
+// stacks with ClientConfig.DownloadRateLimiter. rate.Inf removes the limit.
+func (t *Torrent) SetDownloadRateLimit(limit rate.Limit, burst int) error {
+	return setRateLimit(t.downloadRateLimiter, limit, burst)
+}
+
+func setRateLimit(l *rate.Limiter, limit rate.Limit, burst int) error {
+	// Nothing could ever be transferred.
+	if limit != rate.Inf && burst <= 0 {
+		return fmt.Errorf("burst must be positive for limit %v", limit)
+	}
+	now := time.Now()
+	l.SetBurstAt(now, burst)
+	l.SetLimitAt(now, limit)
+	return nil
+}
+
+func (t *Torrent) bandwidthGroupDownloadLimiter() *rate.Limiter {
+	bg := t.bandwidthGroup.Load()
+	if bg == nil {
+		return nil
+	}
+	return bg.downloadLimiter
+}
+
+// Returns all the limiters that apply to uploads for the Torrent, from the Client down.
+func (t *Torrent) uploadRateLimiters() []*rate.Limiter {
+	ls := []*rate.Limiter{t.cl.config.UploadRateLimiter, t.uploadRateLimiter}
+	if bg := t.bandwidthGroup.Load(); bg != nil {
+		ls = append(ls, bg.uploadLimiter)
+	}
+	return ls
+}
+
+// Wraps r with the Torrent's own and bandwidth group's download limits. The Client-wide limit is
+// applied separately since it's needed before the Torrent is known.
+func (t *Torrent) downloadRateLimitedReader(r io.Reader) io.Reader {
+	return dynamicRateLimitedReader{
+		l: t.bandwidthGroupDownloadLimiter,
+		r: &rateLimitedReader{l: t.downloadRateLimiter, r: r},
+	}
+}
+
+// Reserves n tokens from each limiter for immediate use. If any of them would require waiting, all
+// the reservations are cancelled and the longest delay is returned. ok is false if n exceeds the
+// burst of any limiter.
+func reserveRateLimiters(n int, ls []*rate.Limiter) (delay time.Duration, ok bool) {
+	now := time.Now()
+	rs := make([]*rate.Reservation, 0, len(ls))
+	ok = true
+	for _, l := range ls {
+		r := l.ReserveN(now, n)
+		if !r.OK() {
+			ok = false
+			break
+		}
+		rs = append(rs, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if !ok || delay > 0 {
+		for _, r := range rs {
+			r.CancelAt(now)
+		}
+	}
+	return
+}
+
+// Returns the smallest burst of the limited limiters.
+func minRateLimiterBurst(ls []*rate.Limiter) (ret Option[int]) {
+	for _, l := range ls {
+		if l.Limit() == rate.Inf {
+			continue
+		}
+		if !ret.Ok || l.Burst() < ret.Value {
+			ret = Some(l.Burst())
+		}
+	}
+	return
+}
+
+func rateLimitString(l *rate.Limiter) string {
+	if l.Limit() == rate.Inf {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%v B/s (burst %v)", l.Limit(), l.Burst())
+}
+
+// Adds f to the output of WriteStatus, after the Client-wide rate limits. This is for things that
+// manage the Client from outside, like the scheduler package. f is called with the Client lock
+// held. The returned func removes f.
+func (cl *Client) AddStatusWriter(f func(w io.Writer)) (remove func()) {
+	cl.lock()
+	defer cl.unlock()
+	p := &f
+	cl.statusWriters = append(cl.statusWriters, p)
+	return func() {
+		cl.lock()
+		defer cl.unlock()
+		cl.statusWriters = slices.DeleteFunc(cl.statusWriters, func(e *func(io.Writer)) bool {
+			return e == p
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/time/rate"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestReserveRateLimiters(t *testing.T) {
+	c := qt.New(t)
+	unlimited := rate.NewLimiter(rate.Inf, 0)
+	limited := rate.NewLimiter(1, 10)
+	delay, ok := reserveRateLimiters(10, []*rate.Limiter{unlimited, limited})
+	c.Check(ok, qt.IsTrue)
+	c.Check(delay, qt.Equals, time.Duration(0))
+	// The limited bucket is now empty, so further reservations are delayed and cancelled.
+	delay, ok = reserveRateLimiters(5, []*rate.Limiter{unlimited, limited})
+	c.Check(ok, qt.IsTrue)
+	c.Check(delay > 0, qt.IsTrue)
+	_, ok = reserveRateLimiters(11, []*rate.Limiter{unlimited, limited})
+	c.Check(ok, qt.IsFalse)
+}
+
+func TestTorrentUploadRateLimitersStack(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.UploadRateLimiter = rate.NewLimiter(1000, 1<<16)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	c.Check(minRateLimiterBurst(tt.uploadRateLimiters()), qt.Equals, g.Some(1<<16))
+	c.Assert(tt.SetUploadRateLimit(100, 1<<15), qt.IsNil)
+	c.Check(minRateLimiterBurst(tt.uploadRateLimiters()), qt.Equals, g.Some(1<<15))
+	bg := cl.BandwidthGroup("slow")
+	c.Check(cl.BandwidthGroup("slow"), qt.Equals, bg)
+	c.Assert(bg.SetUploadRateLimit(10, 1<<14), qt.IsNil)
+	tt.SetBandwidthGroup(bg)
+	c.Check(minRateLimiterBurst(tt.uploadRateLimiters()), qt.Equals, g.Some(1<<14))
+	tt.SetBandwidthGroup(nil)
+	c.Check(tt.SetUploadRateLimit(10, 0), qt.IsNotNil)
+	c.Assert(tt.SetUploadRateLimit(rate.Inf, 0), qt.IsNil)
+	c.Check(minRateLimiterBurst(tt.uploadRateLimiters()), qt.Equals, g.Some(1<<16))
+}
+
+func TestClientStatusWriters(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	remove := cl.AddStatusWriter(func(w io.Writer) {
+		fmt.Fprintln(w, "extra status")
+	})
+	var buf bytes.Buffer
+	cl.WriteStatus(&buf)
+	c.Check(buf.String(), qt.Contains, "Upload rate limit: unlimited\n")
+	c.Check(buf.String(), qt.Contains, "extra status\n")
+	remove()
+	buf.Reset()
+	cl.WriteStatus(&buf)
+	c.Check(buf.String(), qt.Not(qt.Contains), "extra status")
+}
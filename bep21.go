@@ -0,0 +1,24 @@
+package torrent
+
+// Whether we don't want any more data, and can tell peers so with BEP 21 upload_only. This
+// includes when we've finished the files we selected. A torrent that has nothing and wants nothing
+// probably hasn't been told what to download yet, and readers can want more data at any moment, so
+// those don't count.
+func (t *Torrent) uploadOnly() bool {
+	return t.haveInfo() && !t.needData() && t.haveAnyPieces() && len(t.readers) == 0
+}
+
+// We don't want any more data, but don't have all of it (BEP 21).
+func (t *Torrent) partialSeed() bool {
+	return t.uploadOnly() && !t.haveAllPieces()
+}
+
+// Tells peers if our upload_only status has changed since their last extended handshake.
+func (t *Torrent) updateUploadOnly() {
+	uploadOnly := t.uploadOnly()
+	for pc := range t.conns {
+		if pc.sentUploadOnly.Ok && pc.sentUploadOnly.Value != uploadOnly {
+			pc.sendExtendedHandshake()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package torrent
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestUploadOnly(t *testing.T) {
+	c := qt.New(t)
+	tt, pc := newDontHaveTestConn(c)
+	tt.cl.lock()
+	defer tt.cl.unlock()
+	// Nothing wanted and nothing had isn't a partial seed.
+	c.Check(tt.uploadOnly(), qt.IsFalse)
+	c.Check(tt.announceRequest(tracker.None, tt.infoHash.Value).Event, qt.Equals, tracker.None)
+	pc.RemoteAddr = &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1}
+	pc.LocalLtepProtocolMap = &tt.cl.defaultLocalLtepProtocolMap
+	pc.sentUploadOnly = g.Some(false)
+	tt._completedPieces.Add(0)
+	c.Check(tt.uploadOnly(), qt.IsTrue)
+	c.Check(tt.partialSeed(), qt.IsTrue)
+	c.Check(tt.announceRequest(tracker.None, tt.infoHash.Value).Event, qt.Equals, tracker.Paused)
+	c.Check(tt.announceRequest(tracker.Started, tt.infoHash.Value).Event, qt.Equals, tracker.Started)
+
+	tt.updateUploadOnly()
+	c.Check(pc.sentUploadOnly, qt.Equals, g.Some(true))
+	var msg pp.Message
+	d := pp.Decoder{
+		R:         bufio.NewReader(pc.messageWriter.writeBuffer),
+		MaxLength: 1 << 20,
+	}
+	c.Assert(d.Decode(&msg), qt.IsNil)
+	var hs pp.ExtendedHandshakeMessage
+	c.Assert(bencode.Unmarshal(msg.ExtendedPayload, &hs), qt.IsNil)
+	c.Check(hs.UploadOnly, qt.IsTrue)
+	// Nothing changed, so nothing more is sent.
+	pc.messageWriter.writeBuffer.Reset()
+	tt.updateUploadOnly()
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 0)
+
+	// Partial seeds don't drop each other, as either might want more data later.
+	tt.cl.config.DropMutuallyCompletePeers = true
+	pc.peerUploadOnly = true
+	tt.maybeDropMutuallyCompletePeer(pc)
+	c.Check(pc.closed.IsSet(), qt.IsFalse)
+
+	tt._completedPieces.AddRange(0, 3)
+	c.Check(tt.partialSeed(), qt.IsFalse)
+	c.Check(tt.announceRequest(tracker.None, tt.infoHash.Value).Event, qt.Equals, tracker.None)
+	// A seed has no use for a peer that doesn't want anything.
+	tt.maybeDropMutuallyCompletePeer(pc)
+	c.Check(pc.closed.IsSet(), qt.IsTrue)
+}
@@ -0,0 +1,36 @@
+package torrent
+
+import (
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Sets the BEP 53 file selection, applying it now if the info is available.
+func (t *Torrent) setSelectOnly(ranges []metainfo.FileIndexRange) {
+	if len(ranges) == 0 {
+		return
+	}
+	t.selectOnly = ranges
+	if t.haveInfo() {
+		t.applySelectOnly()
+		t.updateAllPiecePriorities("TorrentSpec.SelectOnly")
+	}
+}
+
+// Gives the selected files normal priority, and the others none. Indexes beyond the files are
+// ignored.
+func (t *Torrent) applySelectOnly() {
+	ranges := t.selectOnly
+	if ranges == nil {
+		return
+	}
+	t.selectOnly = nil
+	for i, f := range *t.files {
+		f.prio = PiecePriorityNone
+		for _, r := range ranges {
+			if r.Contains(i) {
+				f.prio = PiecePriorityNormal
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package torrent
+
+import (
+	"testing"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestSelectOnlyFilePriorities(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	infoBytes, err := bencode.Marshal(metainfo.Info{
+		Name:        "d",
+		PieceLength: 1,
+		Pieces:      make([]byte, pieceHash.Size()*4),
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 1},
+			{Path: []string{"b"}, Length: 1},
+			{Path: []string{"c"}, Length: 1},
+			{Path: []string{"d"}, Length: 1},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	spec, err := TorrentSpecFromMagnetUri(metainfo.MagnetV2{
+		InfoHash:   g.Some(metainfo.HashBytes(infoBytes)),
+		SelectOnly: []metainfo.FileIndexRange{{1, 2}, {7, 7}},
+	}.String())
+	c.Assert(err, qt.IsNil)
+	c.Check(spec.SelectOnly, qt.DeepEquals, []metainfo.FileIndexRange{{1, 2}, {7, 7}})
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tt.SetInfoBytes(infoBytes), qt.IsNil)
+	priorities := func() (ret []piecePriority) {
+		for _, f := range tt.Files() {
+			ret = append(ret, f.Priority())
+		}
+		return
+	}
+	c.Check(priorities(), qt.DeepEquals, []piecePriority{
+		PiecePriorityNone, PiecePriorityNormal, PiecePriorityNormal, PiecePriorityNone,
+	})
+	c.Check(tt.PieceState(1).Priority, qt.Equals, PiecePriorityNormal)
+	c.Check(tt.PieceState(3).Priority, qt.Equals, PiecePriorityNone)
+	// Merging a selection once the info is known applies it immediately.
+	c.Assert(tt.MergeSpec(&TorrentSpec{SelectOnly: []metainfo.FileIndexRange{{3, 3}}}), qt.IsNil)
+	c.Check(priorities(), qt.DeepEquals, []piecePriority{
+		PiecePriorityNone, PiecePriorityNone, PiecePriorityNone, PiecePriorityNormal,
+	})
+	c.Check(tt.PieceState(3).Priority, qt.Equals, PiecePriorityNormal)
+}
@@ -0,0 +1,65 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+	"slices"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// The number of pieces we allow a peer to request while we choke them.
+const allowedFastSetSize = 10
+
+// Returns the canonical allowed fast set from BEP 6 for a peer with the given IP. BEP 6 only
+// defines it for IPv4, so there isn't one for other addresses.
+func allowedFastSet(ip net.IP, infoHash [20]byte, numPieces, k int) (ret []pieceIndex) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil
+	}
+	if k > numPieces {
+		k = numPieces
+	}
+	x := make([]byte, 0, 4+len(infoHash))
+	x = append(x, ip4.Mask(net.CIDRMask(24, 32))...)
+	x = append(x, infoHash[:]...)
+	for len(ret) < k {
+		sum := sha1.Sum(x)
+		x = sum[:]
+		for i := 0; i < 5 && len(ret) < k; i++ {
+			index := pieceIndex(binary.BigEndian.Uint32(x[i*4:]) % uint32(numPieces))
+			if !slices.Contains(ret, index) {
+				ret = append(ret, index)
+			}
+		}
+	}
+	return
+}
+
+// Sends the peer its allowed fast set, if the fast extension is enabled and we have the info.
+func (c *PeerConn) sendAllowedFast() {
+	if !c.fastEnabled() || !c.t.haveInfo() || !c.sentAllowedFast.IsEmpty() {
+		return
+	}
+	if c.t.superSeedingActive() {
+		// Pieces are only revealed one at a time.
+		return
+	}
+	for _, i := range allowedFastSet(c.remoteIp(), *c.t.canonicalShortInfohash(), c.t.numPieces(), allowedFastSetSize) {
+		c.sentAllowedFast.Add(i)
+		c.write(pp.Message{
+			Type:  pp.AllowedFast,
+			Index: pp.Integer(i),
+		})
+	}
+}
+
+// Whether we'll serve a request for the piece while choking the peer.
+func (c *PeerConn) servesAllowedFast(i pieceIndex) bool {
+	return c.fastEnabled() &&
+		c.sentAllowedFast.Contains(i) &&
+		!c.t.cl.config.NoUpload &&
+		!c.t.dataUploadDisallowed
+}
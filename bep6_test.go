@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// The example from BEP 6.
+func TestAllowedFastSet(t *testing.T) {
+	c := qt.New(t)
+	var infoHash [20]byte
+	for i := range infoHash {
+		infoHash[i] = 0xaa
+	}
+	ip := net.ParseIP("80.4.4.200")
+	c.Check(allowedFastSet(ip, infoHash, 1313, 7), qt.DeepEquals,
+		[]pieceIndex{1059, 431, 808, 1217, 287, 376, 1188})
+	c.Check(allowedFastSet(ip, infoHash, 1313, 9), qt.DeepEquals,
+		[]pieceIndex{1059, 431, 808, 1217, 287, 376, 1188, 353, 508})
+	// The last octet doesn't matter.
+	c.Check(allowedFastSet(net.ParseIP("80.4.4.1"), infoHash, 1313, 7), qt.DeepEquals,
+		allowedFastSet(ip, infoHash, 1313, 7))
+	c.Check(allowedFastSet(ip, infoHash, 3, 7), qt.HasLen, 3)
+	c.Check(allowedFastSet(net.ParseIP("::1"), infoHash, 1313, 7), qt.HasLen, 0)
+}
+
+func TestAllowedFastRequestsWhileChoking(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrentForTesting()
+	c.Assert(tt.setInfo(&metainfo.Info{
+		PieceLength: 1,
+		Length:      20,
+		Pieces:      make([]byte, pieceHash.Size()*20),
+	}), qt.IsNil)
+	tt.onSetInfo()
+	tt._completedPieces.AddRange(0, 20)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.RemoteAddr = &net.TCPAddr{IP: net.ParseIP("80.4.4.200"), Port: 6881}
+	pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+	pc.setTorrent(tt)
+	pc.initMessageWriter()
+	cl.lock()
+	defer cl.unlock()
+	tt.conns[pc] = struct{}{}
+	pc.sendAllowedFast()
+	c.Assert(int(pc.sentAllowedFast.GetCardinality()), qt.Equals, allowedFastSetSize)
+	c.Assert(pc.choking, qt.IsTrue)
+	var allowed, other pieceIndex = -1, -1
+	for i := range 20 {
+		if pc.sentAllowedFast.Contains(i) {
+			allowed = i
+		} else {
+			other = i
+		}
+	}
+	req := func(i pieceIndex) Request {
+		return Request{pp.Integer(i), ChunkSpec{0, 1}}
+	}
+	c.Assert(pc.onReadRequest(req(allowed), false), qt.IsNil)
+	c.Assert(pc.onReadRequest(req(other), false), qt.IsNil)
+	c.Check(pc.peerRequests, qt.HasLen, 1)
+	c.Check(pc.peerRequests[req(allowed)], qt.IsNotNil)
+}
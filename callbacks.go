@@ -34,6 +34,12 @@ type Callbacks struct {
 	// handshake has not yet occurred. This is a good time to alter the supported extension
 	// protocols.
 	PeerConnAdded []func(*PeerConn)
+	// Called when a Torrent reaches one of its SeedLimits, before the configured action is applied.
+	// The Client lock is held.
+	SeedLimitReached []func(SeedLimitReachedEvent)
+	// Called when a piece deadline set with Torrent.SetPieceDeadline passes before the piece is
+	// complete. The Client lock is held.
+	PieceDeadlineMissed []func(PieceDeadlineMissedEvent)
 }
 
 type ReceivedUsefulDataEvent = PeerMessageEvent
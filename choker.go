@@ -0,0 +1,253 @@
+package torrent
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// A peer that's a candidate for unchoking in a choking round.
+type ChokerPeer struct {
+	// Identifies the peer. Don't call methods on it from a Choker, the Client lock is held.
+	Conn    *PeerConn
+	Torrent *Torrent
+	// Whether we have all the Torrent's pieces.
+	Seeding bool
+	// The peer is interested in our pieces, and we're willing to upload to them.
+	Interested bool
+	// Whether the peer is currently unchoked.
+	Unchoked bool
+	// When the peer was last unchoked. Zero if they never have been.
+	LastUnchoked time.Time
+	// The rates of data received from, and sent to the peer over the last choke interval, in bytes
+	// per second. Rounds run early for interest changes reuse the rates from the last interval.
+	DownloadRate float64
+	UploadRate   float64
+}
+
+// Decides which peers we upload to. Choke is called periodically, and when peers become interested
+// or go away, with the Client lock held. It returns the peers to unchoke, and the rest are choked.
+// See ClientConfig.Choker.
+type Choker interface {
+	Choke(now time.Time, peers []ChokerPeer) (unchoke []*PeerConn)
+}
+
+// The standard BitTorrent choking algorithm. Interested peers are ranked by the rate they upload to
+// us while we're leeching, and by the rate we upload to them (or round-robin) while we're seeding.
+// The best ranked get the regular upload slots, and a rotating optimistic unchoke gives other
+// peers a chance to prove themselves.
+type DefaultChoker struct {
+	// Regular upload slots per torrent. Defaults to 4.
+	SlotsPerTorrent int
+	// Regular upload slots across all torrents. Zero means no limit beyond SlotsPerTorrent. Slots
+	// are shared between torrents by rank.
+	Slots int
+	// How long the optimistic unchoke stays with a peer before moving to another. Defaults to 30s.
+	OptimisticUnchokeInterval time.Duration
+	// When seeding, rotate the regular slots between interested peers instead of preferring the
+	// peers we upload to fastest. Each peer keeps its slot for OptimisticUnchokeInterval.
+	SeedRoundRobin bool
+
+	optimistic map[*Torrent]optimisticUnchoke
+}
+
+type optimisticUnchoke struct {
+	conn  *PeerConn
+	since time.Time
+}
+
+const (
+	defaultUploadSlotsPerTorrent     = 4
+	defaultOptimisticUnchokeInterval = 30 * time.Second
+	chokeInterval                    = 10 * time.Second
+)
+
+func (me *DefaultChoker) slotsPerTorrent() int {
+	if me.SlotsPerTorrent <= 0 {
+		return defaultUploadSlotsPerTorrent
+	}
+	return me.SlotsPerTorrent
+}
+
+func (me *DefaultChoker) optimisticUnchokeInterval() time.Duration {
+	if me.OptimisticUnchokeInterval <= 0 {
+		return defaultOptimisticUnchokeInterval
+	}
+	return me.OptimisticUnchokeInterval
+}
+
+func (me *DefaultChoker) Choke(now time.Time, peers []ChokerPeer) (unchoke []*PeerConn) {
+	// Interested peers by torrent, in the order torrents first appear.
+	var torrents []*Torrent
+	candidates := make(map[*Torrent][]ChokerPeer)
+	for _, p := range peers {
+		if !p.Interested {
+			continue
+		}
+		if _, ok := candidates[p.Torrent]; !ok {
+			torrents = append(torrents, p.Torrent)
+		}
+		candidates[p.Torrent] = append(candidates[p.Torrent], p)
+	}
+	for _, t := range torrents {
+		me.rank(now, candidates[t])
+	}
+	regular := make(map[*PeerConn]bool)
+	slots := me.Slots
+	// Hand out slots by rank across the torrents, so that one torrent can't take them all.
+	for rank := 0; rank < me.slotsPerTorrent(); rank++ {
+		for _, t := range torrents {
+			if rank >= len(candidates[t]) || me.Slots > 0 && slots == 0 {
+				continue
+			}
+			c := candidates[t][rank].Conn
+			regular[c] = true
+			unchoke = append(unchoke, c)
+			slots--
+		}
+	}
+	optimistic := make(map[*Torrent]optimisticUnchoke, len(torrents))
+	for _, t := range torrents {
+		var others []*PeerConn
+		for _, p := range candidates[t] {
+			if !regular[p.Conn] {
+				others = append(others, p.Conn)
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+		cur, ok := me.optimistic[t]
+		if !ok || !slices.Contains(others, cur.conn) || now.Sub(cur.since) >= me.optimisticUnchokeInterval() {
+			if ok && len(others) > 1 {
+				// Move the slot to someone else.
+				others = slices.DeleteFunc(others, func(c *PeerConn) bool { return c == cur.conn })
+			}
+			cur = optimisticUnchoke{
+				conn:  others[rand.IntN(len(others))],
+				since: now,
+			}
+		}
+		optimistic[t] = cur
+		unchoke = append(unchoke, cur.conn)
+	}
+	me.optimistic = optimistic
+	return
+}
+
+// Sorts the interested peers of a torrent, best first.
+func (me *DefaultChoker) rank(now time.Time, peers []ChokerPeer) {
+	if len(peers) == 0 {
+		return
+	}
+	if !peers[0].Seeding {
+		slices.SortStableFunc(peers, func(a, b ChokerPeer) int {
+			return -cmp.Compare(a.DownloadRate, b.DownloadRate)
+		})
+		return
+	}
+	if !me.SeedRoundRobin {
+		slices.SortStableFunc(peers, func(a, b ChokerPeer) int {
+			return -cmp.Compare(a.UploadRate, b.UploadRate)
+		})
+		return
+	}
+	// Peers keep their slot for a while, and then the peers that have waited longest go next.
+	keep := func(p ChokerPeer) bool {
+		return p.Unchoked && now.Sub(p.LastUnchoked) < me.optimisticUnchokeInterval()
+	}
+	slices.SortStableFunc(peers, func(a, b ChokerPeer) int {
+		if keepA, keepB := keep(a), keep(b); keepA != keepB {
+			if keepA {
+				return -1
+			}
+			return 1
+		}
+		return a.LastUnchoked.Compare(b.LastUnchoked)
+	})
+}
+
+// Runs choking rounds until the Client is closed.
+func (cl *Client) chokerRunner() {
+	ticker := time.NewTicker(chokeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cl.closed.Done():
+			return
+		case <-ticker.C:
+			cl.lock()
+			cl.chokeRound(time.Now(), true)
+			cl.unlock()
+		case <-cl.chokeSoonC:
+			cl.lock()
+			cl.chokeRound(time.Now(), false)
+			cl.unlock()
+		}
+	}
+}
+
+// Runs a choking round soon, such as when a peer might want one of the upload slots.
+func (cl *Client) chokeSoon() {
+	select {
+	case cl.chokeSoonC <- struct{}{}:
+	default:
+	}
+}
+
+// Runs a choking round. Rates are only measured in periodic rounds, so they cover a full choke
+// interval rather than however long it's been since an early round.
+func (cl *Client) chokeRound(now time.Time, periodic bool) {
+	var peers []ChokerPeer
+	for t := range cl.torrents {
+		seeding := t.haveInfo() && t.haveAllPieces()
+		for c := range t.conns {
+			if periodic {
+				c.sampleChokerRates(now)
+			}
+			p := ChokerPeer{
+				Conn:         c,
+				Torrent:      t,
+				Seeding:      seeding,
+				Interested:   c.peerInterested && c.uploadEligible(),
+				Unchoked:     c.unchokedByChoker,
+				LastUnchoked: c.lastUnchoked,
+				DownloadRate: c.chokerDownloadRate,
+				UploadRate:   c.chokerUploadRate,
+			}
+			peers = append(peers, p)
+		}
+	}
+	unchoke := make(map[*PeerConn]struct{})
+	for _, c := range cl.choker.Choke(now, peers) {
+		unchoke[c] = struct{}{}
+	}
+	for _, p := range peers {
+		c := p.Conn
+		_, want := unchoke[c]
+		if want == c.unchokedByChoker {
+			continue
+		}
+		c.unchokedByChoker = want
+		if want {
+			c.lastUnchoked = now
+		}
+		c.tickleWriter()
+	}
+}
+
+// Updates the rates given to the Choker from the data transferred since the last sample.
+func (c *PeerConn) sampleChokerRates(now time.Time) {
+	read := c._stats.BytesReadData.Int64()
+	written := c._stats.BytesWrittenData.Int64()
+	if !c.chokerSampleTime.IsZero() {
+		if elapsed := now.Sub(c.chokerSampleTime).Seconds(); elapsed > 0 {
+			c.chokerDownloadRate = float64(read-c.chokerBytesRead) / elapsed
+			c.chokerUploadRate = float64(written-c.chokerBytesWritten) / elapsed
+		}
+	}
+	c.chokerSampleTime = now
+	c.chokerBytesRead = read
+	c.chokerBytesWritten = written
+}
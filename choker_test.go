@@ -0,0 +1,138 @@
+package torrent
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func chokerTestPeers(t *Torrent, n int, seeding bool) (ret []ChokerPeer) {
+	for i := range n {
+		ret = append(ret, ChokerPeer{
+			Conn:         &PeerConn{},
+			Torrent:      t,
+			Seeding:      seeding,
+			Interested:   true,
+			DownloadRate: float64(i),
+			UploadRate:   float64(n - i),
+		})
+	}
+	return
+}
+
+func TestDefaultChokerLeeching(t *testing.T) {
+	c := qt.New(t)
+	var ch DefaultChoker
+	peers := chokerTestPeers(&Torrent{}, 8, false)
+	// Uninterested peers never get a slot.
+	peers = append(peers, ChokerPeer{Conn: &PeerConn{}, Torrent: peers[0].Torrent, DownloadRate: 100})
+	now := time.Now()
+	unchoke := ch.Choke(now, peers)
+	c.Assert(unchoke, qt.HasLen, 5)
+	// The fastest peers to upload to us.
+	c.Check(slices.Equal(unchoke[:4], []*PeerConn{peers[7].Conn, peers[6].Conn, peers[5].Conn, peers[4].Conn}), qt.IsTrue)
+	optimistic := unchoke[4]
+	c.Check(peers[8].Conn, qt.Not(qt.Equals), optimistic)
+	// The optimistic unchoke sticks for a while, and then moves on.
+	c.Check(ch.Choke(now.Add(10*time.Second), peers)[4], qt.Equals, optimistic)
+	c.Check(ch.Choke(now.Add(30*time.Second), peers)[4], qt.Not(qt.Equals), optimistic)
+}
+
+func TestDefaultChokerSeeding(t *testing.T) {
+	c := qt.New(t)
+	ch := DefaultChoker{SlotsPerTorrent: 2}
+	peers := chokerTestPeers(&Torrent{}, 2, true)
+	unchoke := ch.Choke(time.Now(), peers)
+	// The peers we upload to fastest, and nobody is left for the optimistic unchoke.
+	c.Check(slices.Equal(unchoke, []*PeerConn{peers[0].Conn, peers[1].Conn}), qt.IsTrue)
+}
+
+func TestDefaultChokerSeedRoundRobin(t *testing.T) {
+	c := qt.New(t)
+	ch := DefaultChoker{SlotsPerTorrent: 1, SeedRoundRobin: true}
+	now := time.Now()
+	peers := chokerTestPeers(&Torrent{}, 3, true)
+	peers[0].Unchoked = true
+	peers[0].LastUnchoked = now.Add(-10 * time.Second)
+	peers[1].LastUnchoked = now.Add(-time.Minute)
+	c.Check(ch.Choke(now, peers)[0], qt.Equals, peers[0].Conn)
+	// Peer 0 has had its turn, and peer 2 has never been unchoked.
+	peers[0].LastUnchoked = now.Add(-time.Minute)
+	c.Check(ch.Choke(now, peers)[0], qt.Equals, peers[2].Conn)
+}
+
+func TestDefaultChokerGlobalSlots(t *testing.T) {
+	c := qt.New(t)
+	ch := DefaultChoker{Slots: 3}
+	a := chokerTestPeers(&Torrent{}, 4, false)
+	b := chokerTestPeers(&Torrent{}, 4, false)
+	unchoke := ch.Choke(time.Now(), append(a, b...))
+	// Regular slots are shared by rank, and each torrent still gets an optimistic unchoke.
+	c.Assert(unchoke, qt.HasLen, 5)
+	c.Check(slices.Equal(unchoke[:3], []*PeerConn{a[3].Conn, b[3].Conn, a[2].Conn}), qt.IsTrue)
+}
+
+type chokeAllChoker struct{}
+
+func (chokeAllChoker) Choke(time.Time, []ChokerPeer) []*PeerConn {
+	return nil
+}
+
+func TestCustomChokerPreventsUpload(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.Choker = chokeAllChoker{}
+	cl, err := NewClient(cfg)
+	qt.Assert(t, err, qt.IsNil)
+	defer cl.Close()
+	tt := cl.newTorrentForTesting()
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.setTorrent(tt)
+	pc.peerInterested = true
+	cl.lock()
+	tt.conns[pc] = struct{}{}
+	cl.chokeRound(time.Now(), true)
+	cl.unlock()
+	qt.Check(t, pc.unchokedByChoker, qt.IsFalse)
+	qt.Check(t, pc.uploadAllowed(), qt.IsFalse)
+}
+
+type recordingChoker struct {
+	peers []ChokerPeer
+}
+
+func (me *recordingChoker) Choke(_ time.Time, peers []ChokerPeer) []*PeerConn {
+	me.peers = peers
+	return nil
+}
+
+func TestChokerRatesMeasuredPerInterval(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	var choker recordingChoker
+	cfg.Choker = &choker
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.setTorrent(tt)
+	cl.lock()
+	defer cl.unlock()
+	tt.conns[pc] = struct{}{}
+	start := time.Now()
+	cl.chokeRound(start, true)
+	pc._stats.BytesReadData.Add(1000)
+	// Rounds run early for interest changes don't measure rates over a few milliseconds.
+	cl.chokeRound(start.Add(time.Millisecond), false)
+	c.Assert(choker.peers, qt.HasLen, 1)
+	c.Check(choker.peers[0].DownloadRate, qt.Equals, 0.0)
+	cl.chokeRound(start.Add(chokeInterval), true)
+	c.Check(choker.peers[0].DownloadRate, qt.Equals, 1000/chokeInterval.Seconds())
+	cl.chokeRound(start.Add(chokeInterval+time.Millisecond), false)
+	c.Check(choker.peers[0].DownloadRate, qt.Equals, 1000/chokeInterval.Seconds())
+}
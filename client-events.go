@@ -0,0 +1,250 @@
+package torrent
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/chansync"
+)
+
+// An event delivered to subscribers of Client.SubscribeEvents. Use a type switch on the concrete
+// *Event types in this package.
+type ClientEvent interface {
+	clientEvent()
+}
+
+type TorrentAddedEvent struct {
+	Torrent *Torrent
+}
+
+type TorrentRemovedEvent struct {
+	Torrent *Torrent
+}
+
+// The Torrent's info became available, such as from peers.
+type MetadataReceivedEvent struct {
+	Torrent *Torrent
+}
+
+type PieceHashedEvent struct {
+	Torrent *Torrent
+	Piece   int
+	Passed  bool
+	// Peers that contributed data to the piece.
+	Peers []PeerRemoteAddr
+	// Set if the piece data couldn't be read from storage.
+	Err error
+}
+
+// All the pieces of a File are complete.
+type FileCompletedEvent struct {
+	File *File
+}
+
+type TorrentCompletedEvent struct {
+	Torrent *Torrent
+}
+
+// A tracker announce finished, successfully if Err is nil.
+type TrackerAnnounceEvent struct {
+	Torrent  *Torrent
+	Tracker  string
+	Err      error
+	NumPeers int
+	Interval time.Duration
+}
+
+type PeerBannedEvent struct {
+	Addr netip.Addr
+}
+
+type StorageErrorEvent struct {
+	Torrent *Torrent
+	Err     error
+}
+
+type ListenerErrorEvent struct {
+	Network string
+	Addr    string
+	Err     error
+}
+
+func (TorrentAddedEvent) clientEvent()        {}
+func (TorrentRemovedEvent) clientEvent()      {}
+func (MetadataReceivedEvent) clientEvent()    {}
+func (PieceHashedEvent) clientEvent()         {}
+func (FileCompletedEvent) clientEvent()       {}
+func (TorrentCompletedEvent) clientEvent()    {}
+func (TrackerAnnounceEvent) clientEvent()     {}
+func (PeerBannedEvent) clientEvent()          {}
+func (StorageErrorEvent) clientEvent()        {}
+func (ListenerErrorEvent) clientEvent()       {}
+func (SeedLimitReachedEvent) clientEvent()    {}
+func (PieceDeadlineMissedEvent) clientEvent() {}
+
+// What to do with events when a subscriber's buffer is full.
+type EventOverflow int
+
+const (
+	// Discard the event. See EventSubscription.Dropped.
+	EventOverflowDrop EventOverflow = iota
+	// Make the goroutine that caused the event wait for room once it has released the Client lock.
+	// That can be any goroutine in the Client, such as those handling peer connections and hashing,
+	// so a slow subscriber slows down the whole Client. A subscriber that causes events while its
+	// buffer is full will wait on itself.
+	EventOverflowBlock
+)
+
+const defaultEventBufferSize = 256
+
+type EventSubscriptionOpts struct {
+	// The number of events buffered for the subscriber. Defaults to 256.
+	BufferSize int
+	Overflow   EventOverflow
+}
+
+// A subscription to Client events. Events are buffered, and delivered in order without holding the
+// Client lock.
+type EventSubscription struct {
+	opts    EventSubscriptionOpts
+	c       chan ClientEvent
+	closing chansync.SetOnce
+	mu      sync.Mutex
+	// Signalled when the queue or closed change.
+	cond    sync.Cond
+	queue   []ClientEvent
+	closed  bool
+	dropped int64
+}
+
+// Subscribes to events from the Client. The subscription ends when it's closed or the Client is.
+func (cl *Client) SubscribeEvents(opts EventSubscriptionOpts) *EventSubscription {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultEventBufferSize
+	}
+	s := &EventSubscription{
+		opts: opts,
+		c:    make(chan ClientEvent),
+	}
+	s.cond.L = &s.mu
+	go s.deliver()
+	cl.lock()
+	defer cl.unlock()
+	if cl.closed.IsSet() {
+		s.Close()
+	} else {
+		cl.eventSubscriptions = append(cl.eventSubscriptions, s)
+	}
+	return s
+}
+
+// Receives the events. It's closed when the subscription ends.
+func (s *EventSubscription) Events() <-chan ClientEvent {
+	return s.c
+}
+
+// Ends the subscription. Events not yet received are discarded.
+func (s *EventSubscription) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.queue = nil
+	s.cond.Broadcast()
+	s.closing.Set()
+}
+
+// The number of events discarded due to EventOverflowDrop.
+func (s *EventSubscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *EventSubscription) deliver() {
+	defer close(s.c)
+	s.mu.Lock()
+	for {
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		ev := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		// There's room for blocked publishers now.
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		select {
+		case s.c <- ev:
+		case <-s.closing.Done():
+			return
+		}
+		s.mu.Lock()
+	}
+}
+
+// Queues the event. Returns true if the publisher should wait for room.
+func (s *EventSubscription) push(ev ClientEvent) (wait bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if len(s.queue) >= s.opts.BufferSize && s.opts.Overflow == EventOverflowDrop {
+		s.dropped++
+		return false
+	}
+	s.queue = append(s.queue, ev)
+	s.cond.Broadcast()
+	return len(s.queue) > s.opts.BufferSize
+}
+
+func (s *EventSubscription) waitForRoom() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) > s.opts.BufferSize && !s.closed {
+		s.cond.Wait()
+	}
+}
+
+func (s *EventSubscription) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Whether there are any subscribers, to avoid building expensive events. The lock must be held.
+func (cl *Client) wantEvents() bool {
+	return len(cl.eventSubscriptions) != 0
+}
+
+// Queues the event for subscribers. The Client lock must be held. It never blocks: publishers wait
+// for room in EventOverflowBlock subscriptions after the lock is released.
+func (cl *Client) publishEvent(ev ClientEvent) {
+	cl.eventSubscriptions = slices.DeleteFunc(cl.eventSubscriptions, (*EventSubscription).isClosed)
+	for _, s := range cl.eventSubscriptions {
+		if s.push(ev) && !slices.Contains(cl.eventSubscriptionsFull, s) {
+			cl.eventSubscriptionsFull = append(cl.eventSubscriptionsFull, s)
+		}
+	}
+}
+
+// Waits for room in subscriptions that events were published to. Must be called without the
+// Client lock.
+func waitForEventSubscriptions(subs []*EventSubscription) {
+	for _, s := range subs {
+		s.waitForRoom()
+	}
+}
+
+func (cl *Client) closeEventSubscriptions() {
+	for _, s := range cl.eventSubscriptions {
+		s.Close()
+	}
+	cl.eventSubscriptions = nil
+}
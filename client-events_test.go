@@ -0,0 +1,196 @@
+package torrent
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestClientEvents(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	sub := cl.SubscribeEvents(EventSubscriptionOpts{})
+	defer sub.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	tt.Drop()
+
+	var got []ClientEvent
+	for {
+		ev := <-sub.Events()
+		if _, ok := ev.(PieceHashedEvent); ok {
+			// There might be several checks of each piece.
+			continue
+		}
+		got = append(got, ev)
+		if _, ok := ev.(TorrentRemovedEvent); ok {
+			break
+		}
+	}
+	want := []ClientEvent{
+		TorrentAddedEvent{tt},
+		MetadataReceivedEvent{tt},
+		FileCompletedEvent{tt.Files()[0]},
+		TorrentCompletedEvent{tt},
+		TorrentRemovedEvent{tt},
+	}
+	c.Assert(got, qt.HasLen, len(want))
+	for i := range want {
+		c.Check(got[i], qt.Equals, want[i])
+	}
+}
+
+func TestSeedLimitAndDeadlineEvents(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = dir
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	sub := cl.SubscribeEvents(EventSubscriptionOpts{})
+	defer sub.Close()
+	seeding, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	seeding.VerifyData()
+	seeding.SetSeedLimits(SeedLimits{MaxRatio: 0.5})
+	seeding.stats.BytesWrittenData.Add(seeding.Length())
+	var wg sync.WaitGroup
+	cl.lock()
+	cl.checkSeedLimits(time.Second, &wg)
+	cl.unlock()
+	wg.Wait()
+	seedLimitEvents := receivedEvents[SeedLimitReachedEvent](cl, sub)
+	c.Assert(seedLimitEvents, qt.HasLen, 1)
+	c.Check(seedLimitEvents[0], qt.Equals, SeedLimitReachedEvent{
+		Torrent: seeding,
+		Reason:  SeedLimitReasonRatio,
+		Action:  SeedLimitActionDisallowDataUpload,
+	})
+
+	info := testutil.Greeting.Info(1)
+	info.Name = "deadlines"
+	var deadlinesMi metainfo.MetaInfo
+	deadlinesMi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(&deadlinesMi)
+	c.Assert(err, qt.IsNil)
+	waitForPieceChecks(tt)
+	past := time.Now().Add(-time.Second)
+	tt.SetPieceDeadline(0, past)
+	deadlineEvents := receivedEvents[PieceDeadlineMissedEvent](cl, sub)
+	c.Assert(deadlineEvents, qt.HasLen, 1)
+	c.Check(deadlineEvents[0], qt.Equals, PieceDeadlineMissedEvent{
+		Torrent:  tt,
+		Piece:    0,
+		Deadline: past,
+	})
+}
+
+func TestEventSubscriptionOverflow(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	publish := func(n int) {
+		cl.lock()
+		for range n {
+			cl.publishEvent(PeerBannedEvent{})
+		}
+		cl.unlock()
+	}
+
+	dropping := cl.SubscribeEvents(EventSubscriptionOpts{BufferSize: 1})
+	publish(3)
+	<-dropping.Events()
+	// At most one event is buffered, and another might have been taken for delivery.
+	c.Check(dropping.Dropped() >= 1, qt.IsTrue)
+	dropping.Close()
+	_, ok := <-dropping.Events()
+	c.Check(ok, qt.IsFalse)
+
+	blocking := cl.SubscribeEvents(EventSubscriptionOpts{
+		BufferSize: 1,
+		Overflow:   EventOverflowBlock,
+	})
+	defer blocking.Close()
+	published := make(chan struct{})
+	go func() {
+		publish(4)
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publisher didn't block")
+	case <-time.After(10 * time.Millisecond):
+	}
+	// The Client lock isn't held while the publisher blocks.
+	cl.rLock()
+	cl.rUnlock()
+	for range 4 {
+		<-blocking.Events()
+	}
+	<-published
+	c.Check(blocking.Dropped(), qt.Equals, int64(0))
+
+	// Events published by actions deferred to unlock are waited on by the same unlock.
+	published = make(chan struct{})
+	go func() {
+		cl.lock()
+		cl.locker().Defer(func() {
+			for range 4 {
+				cl.publishEvent(PeerBannedEvent{})
+			}
+		})
+		cl.unlock()
+		close(published)
+	}()
+	for range 4 {
+		<-blocking.Events()
+	}
+	<-published
+	cl.lock()
+	c.Check(cl.eventSubscriptionsFull, qt.HasLen, 0)
+	cl.unlock()
+}
+
+// Marks the end of the events published so far.
+type testSyncEvent struct{}
+
+func (testSyncEvent) clientEvent() {}
+
+// Returns the events of type T published to the subscription before now.
+func receivedEvents[T ClientEvent](cl *Client, sub *EventSubscription) (ret []T) {
+	cl.lock()
+	cl.publishEvent(testSyncEvent{})
+	cl.unlock()
+	for ev := range sub.Events() {
+		switch ev := ev.(type) {
+		case testSyncEvent:
+			return
+		case T:
+			ret = append(ret, ev)
+		}
+	}
+	return
+}
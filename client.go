@@ -35,6 +35,7 @@ import (
 	"github.com/dustin/go-humanize"
 	gbtree "github.com/google/btree"
 	"github.com/pion/datachannel"
+	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/internal/check"
@@ -89,6 +90,21 @@ type Client struct {
 	acceptLimiter map[ipStr]int
 	numHalfOpen   int
 
+	// All Torrents in queue order. See ClientConfig.ActiveDownloadsLimit.
+	queue              []*Torrent
+	queueUpdatePending bool
+
+	bandwidthGroups map[string]*BandwidthGroup
+	statusWriters   []*func(io.Writer)
+
+	eventSubscriptions []*EventSubscription
+	// Subscriptions that are over their buffer size and block, that the current lock holder must
+	// wait on after unlocking.
+	eventSubscriptionsFull []*EventSubscription
+
+	choker     Choker
+	chokeSoonC chan struct{}
+
 	websocketTrackers websocketTrackers
 
 	activeAnnounceLimiter limiter.Instance
@@ -152,6 +168,12 @@ func (cl *Client) WriteStatus(_w io.Writer) {
 	fmt.Fprintf(w, "Extension bits: %v\n", cl.config.Extensions)
 	fmt.Fprintf(w, "Announce key: %x\n", cl.announceKey())
 	fmt.Fprintf(w, "Banned IPs: %d\n", len(cl.badPeerIPsLocked()))
+	fmt.Fprintf(w, "Upload rate limit: %s\n", rateLimitString(cl.config.UploadRateLimiter))
+	fmt.Fprintf(w, "Download rate limit: %s\n", rateLimitString(cl.config.DownloadRateLimiter))
+	fmt.Fprintf(w, "Dial rate limit: %s\n", rateLimitString(cl.config.DialRateLimiter))
+	for _, f := range cl.statusWriters {
+		(*f)(w)
+	}
 	cl.eachDhtServer(func(s DhtServer) {
 		fmt.Fprintf(w, "%s DHT server at %s:\n", s.Addr().Network(), s.Addr().String())
 		writeDhtServerStatus(w, s)
@@ -159,6 +181,7 @@ func (cl *Client) WriteStatus(_w io.Writer) {
 	dumpStats(w, cl.statsLocked())
 	torrentsSlice := cl.torrentsAsSlice()
 	fmt.Fprintf(w, "# Torrents: %d\n", len(torrentsSlice))
+	cl.writeQueueStatus(w)
 	fmt.Fprintln(w)
 	sort.Slice(torrentsSlice, func(l, r int) bool {
 		return torrentsSlice[l].canonicalShortInfohash().AsString() < torrentsSlice[r].canonicalShortInfohash().AsString()
@@ -210,6 +233,11 @@ func (cl *Client) init(cfg *ClientConfig) {
 	cl.torrentsByShortHash = make(map[metainfo.Hash]*Torrent)
 	cl.activeAnnounceLimiter.SlotsPerKey = 2
 	cl.event.L = cl.locker()
+	cl.choker = cfg.Choker
+	if cl.choker == nil {
+		cl.choker = &DefaultChoker{}
+	}
+	cl.chokeSoonC = make(chan struct{}, 1)
 	cl.ipBlockList = cfg.IPBlocklist
 	cl.httpClient = &http.Client{
 		Transport: cfg.WebTransport,
@@ -234,6 +262,9 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	cl = &Client{}
 	cl.init(cfg)
 	go cl.acceptLimitClearer()
+	go cl.queueUpdater()
+	go cl.seedLimitsChecker()
+	go cl.chokerRunner()
 	cl.initLogger()
 	defer func() {
 		if err != nil {
@@ -464,6 +495,7 @@ func (cl *Client) Close() (errs []error) {
 	for i := range cl.onClose {
 		cl.onClose[len(cl.onClose)-1-i]()
 	}
+	cl.closeEventSubscriptions()
 	cl.closed.Set()
 	cl.unlock()
 	cl.event.Broadcast()
@@ -557,6 +589,13 @@ func (cl *Client) acceptConnections(l Listener) {
 		}
 		if err != nil {
 			log.Fmsg("error accepting connection: %s", err).LogLevel(log.Debug, cl.logger)
+			cl.lock()
+			cl.publishEvent(ListenerErrorEvent{
+				Network: l.Addr().Network(),
+				Addr:    l.Addr().String(),
+				Err:     err,
+			})
+			cl.unlock()
 			continue
 		}
 		go func() {
@@ -1069,10 +1108,14 @@ func (cl *Client) runReceivedConn(c *PeerConn) {
 		cl.unlock()
 		return
 	}
-	torrent.Add("received handshake for loaded torrent", 1)
-	c.conn.SetWriteDeadline(time.Time{})
 	cl.lock()
 	defer cl.unlock()
+	if !t.networkingEnabled.Bool() {
+		torrent.Add("received handshake for torrent with networking disabled", 1)
+		return
+	}
+	torrent.Add("received handshake for loaded torrent", 1)
+	c.conn.SetWriteDeadline(time.Time{})
 	t.runHandshookConnLoggingErr(c)
 }
 
@@ -1098,6 +1141,7 @@ func (t *Torrent) runHandshookConn(pc *PeerConn) error {
 		t.logger.Levelf(log.Debug, "local and remote peer ids are the same")
 		return nil
 	}
+	pc.r = t.downloadRateLimitedReader(pc.r)
 	pc.r = deadlineReader{pc.conn, pc.r}
 	completedHandshakeConnectionFlags.Add(pc.connectionFlags(), 1)
 	if connIsIpv6(pc.conn) {
@@ -1158,32 +1202,47 @@ func (c *Peer) updateRequestsTimerFunc() {
 // (1<<19) cached for sending, for 16KiB (1<<14) chunks.
 const localClientReqq = 1024
 
+// This can be sent again to update the peer, see BEP 10.
+func (pc *PeerConn) sendExtendedHandshake() {
+	t := pc.t
+	cl := t.cl
+	msg := pp.ExtendedHandshakeMessage{
+		V:            cl.config.ExtendedHandshakeClientVersion,
+		Reqq:         localClientReqq,
+		YourIp:       pp.CompactIp(pc.remoteIp()),
+		Encryption:   cl.config.HeaderObfuscationPolicy.Preferred || !cl.config.HeaderObfuscationPolicy.RequirePreferred,
+		Port:         cl.incomingPeerPort(),
+		MetadataSize: t.metadataSize(),
+		UploadOnly:   t.uploadOnly(),
+		// TODO: We can figure these out specific to the socket used.
+		Ipv4: pp.CompactIp(cl.config.PublicIp4.To4()),
+		Ipv6: cl.config.PublicIp6.To16(),
+	}
+	msg.M = pc.LocalLtepProtocolMap.toSupportedExtensionDict()
+	pc.write(pp.Message{
+		Type:            pp.Extended,
+		ExtendedID:      pp.HandshakeExtendedID,
+		ExtendedPayload: bencode.MustMarshal(msg),
+	})
+	pc.sentUploadOnly.Set(msg.UploadOnly)
+}
+
 // See the order given in Transmission's tr_peerMsgsNew.
 func (pc *PeerConn) sendInitialMessages() {
 	t := pc.t
 	cl := t.cl
 	if pc.PeerExtensionBytes.SupportsExtended() && cl.config.Extensions.SupportsExtended() {
-		pc.write(pp.Message{
-			Type:       pp.Extended,
-			ExtendedID: pp.HandshakeExtendedID,
-			ExtendedPayload: func() []byte {
-				msg := pp.ExtendedHandshakeMessage{
-					V:            cl.config.ExtendedHandshakeClientVersion,
-					Reqq:         localClientReqq,
-					YourIp:       pp.CompactIp(pc.remoteIp()),
-					Encryption:   cl.config.HeaderObfuscationPolicy.Preferred || !cl.config.HeaderObfuscationPolicy.RequirePreferred,
-					Port:         cl.incomingPeerPort(),
-					MetadataSize: t.metadataSize(),
-					// TODO: We can figure these out specific to the socket used.
-					Ipv4: pp.CompactIp(cl.config.PublicIp4.To4()),
-					Ipv6: cl.config.PublicIp6.To16(),
-				}
-				msg.M = pc.LocalLtepProtocolMap.toSupportedExtensionDict()
-				return bencode.MustMarshal(msg)
-			}(),
-		})
+		pc.sendExtendedHandshake()
 	}
 	func() {
+		if t.superSeedingActive() {
+			// Pieces are revealed one at a time instead.
+			if pc.fastEnabled() {
+				pc.write(pp.Message{Type: pp.HaveNone})
+			}
+			t.superSeedOffer(pc)
+			return
+		}
 		if pc.fastEnabled() {
 			if t.haveAllPieces() {
 				pc.write(pp.Message{Type: pp.HaveAll})
@@ -1197,6 +1256,7 @@ func (pc *PeerConn) sendInitialMessages() {
 		}
 		pc.postBitfield()
 	}()
+	pc.sendAllowedFast()
 	if pc.PeerExtensionBytes.SupportsDHT() && cl.config.Extensions.SupportsDHT() && cl.haveDhtServer() {
 		pc.write(pp.Message{
 			Type: pp.Port,
@@ -1335,6 +1395,9 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 		},
 		webSeeds:     make(map[string]*Peer),
 		gotMetainfoC: make(chan struct{}),
+
+		uploadRateLimiter:   rate.NewLimiter(rate.Inf, 0),
+		downloadRateLimiter: rate.NewLimiter(rate.Inf, 0),
 	}
 	var salt [8]byte
 	rand.Read(salt[:])
@@ -1390,6 +1453,8 @@ func (cl *Client) AddTorrentInfoHashWithStorage(
 	})
 	cl.torrentsByShortHash[infoHash] = t
 	cl.torrents[t] = struct{}{}
+	cl.addToQueue(t)
+	cl.publishEvent(TorrentAddedEvent{t})
 	cl.clearAcceptLimits()
 	t.updateWantPeersEvent()
 	// Tickle Client.waitAccept, new torrent may want conns.
@@ -1415,6 +1480,14 @@ func (cl *Client) AddTorrentOpt(opts AddTorrentOpts) (t *Torrent, new bool) {
 	}
 	new = true
 
+	if rd := opts.ResumeData; rd != nil {
+		if opts.InfoBytes == nil {
+			opts.InfoBytes = rd.InfoBytes
+		}
+		if opts.ChunkSize == 0 {
+			opts.ChunkSize = pp.Integer(rd.ChunkSize)
+		}
+	}
 	t = cl.newTorrentOpt(opts)
 	cl.eachDhtServer(func(s DhtServer) {
 		if cl.config.PeriodicallyAnnounceTorrentsToDht {
@@ -1423,6 +1496,11 @@ func (cl *Client) AddTorrentOpt(opts AddTorrentOpts) (t *Torrent, new bool) {
 	})
 	cl.torrentsByShortHash[infoHash] = t
 	cl.torrents[t] = struct{}{}
+	cl.addToQueue(t)
+	if opts.ResumeData != nil {
+		t.addResumeData(opts.ResumeData)
+	}
+	cl.publishEvent(TorrentAddedEvent{t})
 	t.setInfoBytesLocked(opts.InfoBytes)
 	cl.clearAcceptLimits()
 	t.updateWantPeersEvent()
@@ -1437,6 +1515,8 @@ type AddTorrentOpts struct {
 	Storage    storage.ClientImpl
 	ChunkSize  pp.Integer
 	InfoBytes  []byte
+	// State from Torrent.ResumeData. Pieces it records as complete aren't checked again.
+	ResumeData *ResumeData
 }
 
 // Add or merge a torrent spec. Returns new if the torrent wasn't already in the client. See also
@@ -1497,6 +1577,7 @@ func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 	t.maybeNewConns()
 	t.dataDownloadDisallowed.SetBool(spec.DisallowDataDownload)
 	t.dataUploadDisallowed = spec.DisallowDataUpload
+	t.setSelectOnly(spec.SelectOnly)
 	return t.AddPieceLayers(spec.PieceLayers)
 }
 
@@ -1506,6 +1587,10 @@ func (cl *Client) dropTorrent(t *Torrent, wg *sync.WaitGroup) (err error) {
 	})
 	err = t.close(wg)
 	delete(cl.torrents, t)
+	cl.removeFromQueue(t)
+	if err == nil {
+		cl.publishEvent(TorrentRemovedEvent{t})
+	}
 	return
 }
 
@@ -1607,6 +1692,7 @@ func (cl *Client) banPeerIP(ip net.IP) {
 		panic(ip)
 	}
 	g.MakeMapIfNilAndSet(&cl.badPeerIPs, ipAddr, struct{}{})
+	cl.publishEvent(PeerBannedEvent{ipAddr})
 	for t := range cl.torrents {
 		t.iterPeers(func(p *Peer) {
 			if p.remoteIp().Equal(ip) {
@@ -1821,7 +1907,12 @@ func (cl *Client) lock() {
 }
 
 func (cl *Client) unlock() {
+	// Deferred actions can publish events too.
+	cl._mu.runUnlockActions()
+	full := cl.eventSubscriptionsFull
+	cl.eventSubscriptionsFull = nil
 	cl._mu.Unlock()
+	waitForEventSubscriptions(full)
 }
 
 func (cl *Client) locker() *lockWithDeferreds {
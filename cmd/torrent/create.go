@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/anacrolix/bargle"
 	"github.com/anacrolix/tagflag"
+	"github.com/dustin/go-humanize"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/metainfo"
@@ -26,7 +33,13 @@ func create() (cmd bargle.Command) {
 		PieceLength       tagflag.Bytes
 		Url               []string `name:"u" help:"add webseed url"`
 		Private           *bool
-		Root              string `arg:"positional"`
+		V2                bool     `help:"create a BitTorrent v2 torrent"`
+		Hybrid            bool     `help:"create a torrent for both BitTorrent v1 and v2"`
+		FileAttrs         bool     `help:"record executable and hidden file attributes"`
+		RecordSymlinks    bool     `help:"record symlinks instead of following them"`
+		Include           []string `help:"only include files matching glob pattern"`
+		Exclude           []string `help:"exclude files matching glob pattern, like .git/ or *.tmp"`
+		Root              string   `arg:"positional"`
 	}
 	cmd = bargle.FromStruct(&args)
 	cmd.Desc = "Creates a torrent metainfo for the file system rooted at ROOT, and outputs it to stdout"
@@ -52,7 +65,28 @@ func create() (cmd bargle.Command) {
 			PieceLength: args.PieceLength.Int64(),
 			Private:     args.Private,
 		}
-		err = info.BuildFromFilePath(args.Root)
+		builder := metainfo.Builder{
+			Progress:  createProgress(),
+			FileAttrs: args.FileAttrs,
+			Include:   args.Include,
+			Exclude:   args.Exclude,
+		}
+		if args.RecordSymlinks {
+			builder.Symlinks = metainfo.RecordSymlinks
+		}
+		switch {
+		case args.V2 && args.Hybrid:
+			return errors.New("--v2 and --hybrid are mutually exclusive")
+		case args.V2:
+			builder.Version = metainfo.BuildV2
+		case args.Hybrid:
+			builder.Version = metainfo.BuildHybrid
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		mi.PieceLayers, err = builder.BuildFromFilePath(ctx, &info, args.Root)
+		// Ends the progress line.
+		fmt.Fprintln(os.Stderr)
 		if err != nil {
 			return
 		}
@@ -68,3 +102,25 @@ func create() (cmd bargle.Command) {
 	}
 	return
 }
+
+// Returns a Builder progress callback that rewrites a progress line on stderr, at most a few times a
+// second.
+func createProgress() func(metainfo.BuildProgress) {
+	var last time.Time
+	return func(p metainfo.BuildProgress) {
+		if p.PiecesDone != p.PiecesTotal && time.Since(last) < 100*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		fmt.Fprintf(
+			os.Stderr,
+			"\rhashing: %s/%s, %d/%d files, %d/%d pieces",
+			humanize.Bytes(uint64(p.BytesDone)),
+			humanize.Bytes(uint64(p.BytesTotal)),
+			p.FilesDone,
+			p.FilesTotal,
+			p.PiecesDone,
+			p.PiecesTotal,
+		)
+	}
+}
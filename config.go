@@ -190,6 +190,21 @@ type ClientConfig struct {
 	DialRateLimiter *rate.Limiter
 
 	PieceHashersPerTorrent int // default: 2
+
+	// The number of torrents that may download and seed at once. The rest are queued, with
+	// networking disabled, in order of Torrent.QueuePosition. Zero means no limit.
+	ActiveDownloadsLimit int
+	ActiveSeedsLimit     int
+	// Active downloads that receive no useful data for this long are moved to the back of the
+	// queue if other downloads are waiting, giving up their download slot. Zero disables stall
+	// detection.
+	QueueStallTimeout time.Duration
+
+	// Default limits on seeding. See Torrent.SetSeedLimits.
+	SeedLimits SeedLimits
+
+	// Decides which peers get upload slots. Defaults to a new DefaultChoker for each Client.
+	Choker Choker
 }
 
 func (cfg *ClientConfig) SetListenAddr(addr string) *ClientConfig {
@@ -219,8 +234,8 @@ func NewDefaultClientConfig() *ClientConfig {
 		KeepAliveTimeout:               time.Minute,
 		MaxAllocPeerRequestDataPerConn: 1 << 20,
 		ListenHost:                     func(string) string { return "" },
-		UploadRateLimiter:              unlimited,
-		DownloadRateLimiter:            unlimited,
+		UploadRateLimiter:              rate.NewLimiter(rate.Inf, 0),
+		DownloadRateLimiter:            rate.NewLimiter(rate.Inf, 0),
 		DisableAcceptRateLimiting:      true,
 		DropMutuallyCompletePeers:      true,
 		HeaderObfuscationPolicy: HeaderObfuscationPolicy{
@@ -0,0 +1,234 @@
+package torrent
+
+import (
+	"time"
+
+	"github.com/anacrolix/log"
+)
+
+const (
+	// Pieces this close to their deadline are only requested from the fastest peers that have
+	// them.
+	pieceDeadlineCriticalWindow = 5 * time.Second
+	// Pieces this close to their deadline, or past it, are late. Their chunks may be requested
+	// from more than one peer at once.
+	pieceDeadlineLateMargin = time.Second
+	// How many of the fastest peers that have a piece may request it when it's critical.
+	pieceDeadlineFastPeers = 3
+	// How many peers in addition to the original may have a request for a late piece.
+	maxPieceDeadlineDuplicateRequests = 2
+)
+
+type pieceDeadline struct {
+	at     time.Time
+	missed bool
+}
+
+type PieceDeadlineMissedEvent struct {
+	Torrent  *Torrent
+	Piece    int
+	Deadline time.Time
+}
+
+// Sets a time by which the piece should be complete. Pieces with deadlines are wanted at
+// PiecePriorityHigh, and requested in deadline order ahead of other pieces of the same priority.
+// Close to the deadline the piece is requested from the fastest peers, and when late, from several
+// peers at once. Callbacks.PieceDeadlineMissed is called if the deadline passes before the piece
+// completes. The deadline is removed when the piece completes. A zero deadline removes the
+// deadline. The Torrent must have its info.
+func (t *Torrent) SetPieceDeadline(piece int, deadline time.Time) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.setPieceDeadline(piece, deadline)
+	t.checkPieceDeadlines()
+}
+
+// Sets the deadline for all the pieces that contain the byte range. See SetPieceDeadline.
+func (t *Torrent) SetRangeDeadline(off, length int64, deadline time.Time) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	begin, end := t.byteRegionPieces(off, length)
+	for i := begin; i < end; i++ {
+		t.setPieceDeadline(i, deadline)
+	}
+	t.checkPieceDeadlines()
+}
+
+// Returns the deadline set with SetPieceDeadline, or the zero Time if there isn't one.
+func (t *Torrent) PieceDeadline(piece int) time.Time {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.pieceDeadlines[piece].at
+}
+
+func (t *Torrent) setPieceDeadline(piece pieceIndex, deadline time.Time) {
+	if deadline.IsZero() {
+		if _, ok := t.pieceDeadlines[piece]; !ok {
+			return
+		}
+		delete(t.pieceDeadlines, piece)
+	} else {
+		if t.pieceComplete(piece) {
+			return
+		}
+		if t.pieceDeadlines == nil {
+			t.pieceDeadlines = make(map[pieceIndex]pieceDeadline)
+		}
+		t.pieceDeadlines[piece] = pieceDeadline{at: deadline}
+	}
+	t.updatePiecePriority(piece, "Torrent.SetPieceDeadline")
+	t.iterPeers(func(p *Peer) {
+		if p.peerHasPiece(piece) {
+			p.updateRequests("Torrent.SetPieceDeadline")
+		}
+	})
+}
+
+func (t *Torrent) pieceDeadline(piece pieceIndex) time.Time {
+	return t.pieceDeadlines[piece].at
+}
+
+// Whether the piece should only be requested from the fastest peers.
+func (t *Torrent) pieceDeadlineCritical(piece pieceIndex) bool {
+	d, ok := t.pieceDeadlines[piece]
+	return ok && time.Until(d.at) < pieceDeadlineCriticalWindow
+}
+
+// Whether requests for the piece may be made to more than one peer.
+func (t *Torrent) pieceDeadlineLate(piece pieceIndex) bool {
+	d, ok := t.pieceDeadlines[piece]
+	return ok && time.Until(d.at) < pieceDeadlineLateMargin
+}
+
+// Whether p is one of the fastest peers that have the piece.
+func (t *Torrent) fastPeerForPiece(p *Peer, piece pieceIndex) bool {
+	rate := p.downloadRate()
+	faster := 0
+	t.iterPeers(func(o *Peer) {
+		if o != p && o.peerHasPiece(piece) && o.downloadRate() > rate {
+			faster++
+		}
+	})
+	return faster < pieceDeadlineFastPeers
+}
+
+// Whether p should request r alongside the peer that has already requested it.
+func (t *Torrent) allowDuplicateRequest(r RequestIndex) bool {
+	return t.pieceDeadlineLate(t.pieceIndexOfRequestIndex(r)) &&
+		len(t.duplicateRequests[r]) < maxPieceDeadlineDuplicateRequests
+}
+
+func (t *Torrent) addDuplicateRequest(r RequestIndex, state requestState) {
+	if t.duplicateRequests == nil {
+		t.duplicateRequests = make(map[RequestIndex][]requestState)
+	}
+	t.duplicateRequests[r] = append(t.duplicateRequests[r], state)
+}
+
+// Removes p's duplicate request. Returns false if it didn't have one.
+func (t *Torrent) deleteDuplicateRequest(r RequestIndex, p *Peer) bool {
+	dups := t.duplicateRequests[r]
+	for i, state := range dups {
+		if state.peer != p {
+			continue
+		}
+		dups = append(dups[:i], dups[i+1:]...)
+		if len(dups) == 0 {
+			delete(t.duplicateRequests, r)
+		} else {
+			t.duplicateRequests[r] = dups
+		}
+		return true
+	}
+	return false
+}
+
+// Makes a duplicate request for r the main one after the main requester's request is removed.
+func (t *Torrent) promoteDuplicateRequest(r RequestIndex) {
+	dups := t.duplicateRequests[r]
+	if len(dups) == 0 {
+		return
+	}
+	t.requestState[r] = dups[0]
+	t.deleteDuplicateRequest(r, dups[0].peer)
+}
+
+func (t *Torrent) onPieceDeadlineCompleted(piece pieceIndex) {
+	if _, ok := t.pieceDeadlines[piece]; !ok {
+		return
+	}
+	delete(t.pieceDeadlines, piece)
+	t.updateDeadlineTimer()
+}
+
+// Schedules a check for the next time a deadline becomes critical, late, or missed.
+func (t *Torrent) updateDeadlineTimer() {
+	now := time.Now()
+	var next time.Time
+	for _, d := range t.pieceDeadlines {
+		for _, at := range [...]time.Time{
+			d.at.Add(-pieceDeadlineCriticalWindow),
+			d.at.Add(-pieceDeadlineLateMargin),
+			d.at,
+		} {
+			if at.After(now) && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
+		}
+	}
+	if next.IsZero() {
+		if t.deadlineTimer != nil {
+			t.deadlineTimer.Stop()
+		}
+		return
+	}
+	if t.deadlineTimer == nil {
+		t.deadlineTimer = time.AfterFunc(next.Sub(now), t.onDeadlineTimer)
+	} else {
+		t.deadlineTimer.Reset(next.Sub(now))
+	}
+}
+
+func (t *Torrent) onDeadlineTimer() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if t.closed.IsSet() {
+		return
+	}
+	t.checkPieceDeadlines()
+}
+
+// Reports missed deadlines, and updates requests for pieces that became critical or late.
+func (t *Torrent) checkPieceDeadlines() {
+	now := time.Now()
+	for i, d := range t.pieceDeadlines {
+		if d.missed || now.Before(d.at) {
+			continue
+		}
+		d.missed = true
+		t.pieceDeadlines[i] = d
+		t.logger.Levelf(log.Debug, "missed deadline %v for piece %v", d.at, i)
+		ev := PieceDeadlineMissedEvent{
+			Torrent:  t,
+			Piece:    i,
+			Deadline: d.at,
+		}
+		for _, f := range t.cl.config.Callbacks.PieceDeadlineMissed {
+			f(ev)
+		}
+		t.cl.publishEvent(ev)
+	}
+	t.iterPeers(func(p *Peer) {
+		p.updateRequests("piece deadlines")
+	})
+	t.updateDeadlineTimer()
+}
+
+func (t *Torrent) numMissedPieceDeadlines() (ret int) {
+	for _, d := range t.pieceDeadlines {
+		if d.missed {
+			ret++
+		}
+	}
+	return
+}
@@ -0,0 +1,183 @@
+package torrent
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestPieceDeadlines(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	var missed []PieceDeadlineMissedEvent
+	cfg.Callbacks.PieceDeadlineMissed = append(cfg.Callbacks.PieceDeadlineMissed, func(e PieceDeadlineMissedEvent) {
+		missed = append(missed, e)
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	info := testutil.Greeting.Info(1)
+	var mi metainfo.MetaInfo
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(&mi)
+	c.Assert(err, qt.IsNil)
+	waitForPieceChecks(tt)
+
+	future := time.Now().Add(time.Hour)
+	tt.SetRangeDeadline(2, 3, future)
+	c.Check(tt.PieceDeadline(1).IsZero(), qt.IsTrue)
+	for i := 2; i < 5; i++ {
+		c.Check(tt.PieceDeadline(i), qt.Equals, future)
+		c.Check(tt.Piece(i).State().Priority, qt.Equals, PiecePriorityHigh)
+	}
+	c.Check(tt.PieceDeadline(5).IsZero(), qt.IsTrue)
+	c.Check(tt.Piece(5).State().Priority, qt.Equals, PiecePriorityNone)
+	tt.cl.rLock()
+	c.Check(tt.requestStrategyPieceOrderState(2).Deadline, qt.Equals, future)
+	c.Check(tt.pieceDeadlineCritical(2), qt.IsFalse)
+	tt.cl.rUnlock()
+	c.Check(missed, qt.HasLen, 0)
+
+	past := time.Now().Add(-time.Second)
+	tt.SetPieceDeadline(0, past)
+	c.Assert(missed, qt.HasLen, 1)
+	c.Check(missed[0].Piece, qt.Equals, 0)
+	c.Check(missed[0].Deadline, qt.Equals, past)
+	tt.cl.rLock()
+	c.Check(tt.pieceDeadlineLate(0), qt.IsTrue)
+	tt.cl.rUnlock()
+	// Missed deadlines are only reported once.
+	tt.SetPieceDeadline(1, future)
+	c.Check(missed, qt.HasLen, 1)
+
+	tt.SetPieceDeadline(2, time.Time{})
+	c.Check(tt.PieceDeadline(2).IsZero(), qt.IsTrue)
+	c.Check(tt.Piece(2).State().Priority, qt.Equals, PiecePriorityNone)
+}
+
+func TestDuplicateRequests(t *testing.T) {
+	c := qt.New(t)
+	var tt Torrent
+	tt.requestState = make(map[RequestIndex]requestState)
+	var a, b, d Peer
+	tt.requestState[0] = requestState{peer: &a}
+	tt.addDuplicateRequest(0, requestState{peer: &b})
+	tt.addDuplicateRequest(0, requestState{peer: &d})
+	c.Check(tt.deleteDuplicateRequest(0, &a), qt.IsFalse)
+	c.Check(tt.deleteDuplicateRequest(0, &d), qt.IsTrue)
+	delete(tt.requestState, 0)
+	tt.promoteDuplicateRequest(0)
+	c.Check(tt.requestingPeer(0), qt.Equals, &b)
+	c.Check(tt.duplicateRequests, qt.HasLen, 0)
+}
+
+// Duplicate requests for late pieces are made and removed through the usual request paths.
+func TestDuplicateRequestsForLatePiece(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	info := testutil.Greeting.Info(1)
+	var mi metainfo.MetaInfo
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(&mi)
+	c.Assert(err, qt.IsNil)
+	waitForPieceChecks(tt)
+	for i := range 3 {
+		tt.SetPieceDeadline(i, time.Now().Add(-time.Second))
+	}
+	cl.lock()
+	defer cl.unlock()
+	newPeer := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+		pc.RemoteAddr = &net.TCPAddr{IP: net.IPv4(1, 2, 3, byte(len(tt.conns))), Port: 1}
+		pc.setTorrent(tt)
+		pc.initMessageWriter()
+		pc.peerChoking = false
+		pc.onPeerHasAllPiecesNoTriggers()
+		tt.conns[pc] = struct{}{}
+		return pc
+	}
+	a, b := newPeer(), newPeer()
+	sentCancel := func(pc *PeerConn, r RequestIndex) bool {
+		d := pp.Decoder{
+			R:         bufio.NewReader(pc.messageWriter.writeBuffer),
+			MaxLength: 1 << 20,
+		}
+		for {
+			var msg pp.Message
+			if d.Decode(&msg) != nil {
+				return false
+			}
+			if msg.Type == pp.Cancel && tt.requestIndexFromRequest(newRequestFromMessage(&msg)) == r {
+				return true
+			}
+		}
+	}
+	requestFromBoth := func(r RequestIndex) {
+		for _, pc := range []*PeerConn{a, b} {
+			_, err := pc.request(r)
+			c.Assert(err, qt.IsNil)
+		}
+		c.Assert(tt.requestingPeer(r), qt.Equals, &a.Peer)
+		c.Assert(tt.duplicateRequests[r], qt.HasLen, 1)
+	}
+	noRequests := func() {
+		c.Check(tt.requestState, qt.HasLen, 0)
+		c.Check(tt.duplicateRequests, qt.HasLen, 0)
+	}
+
+	// Receiving the chunk from the duplicate requester cancels the original request.
+	requestFromBoth(0)
+	ppReq := tt.requestIndexToRequest(0)
+	err = b.receiveChunk(&pp.Message{
+		Type:  pp.Piece,
+		Index: ppReq.Index,
+		Begin: ppReq.Begin,
+		Piece: []byte(testutil.GreetingFileContents[:ppReq.Length]),
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(sentCancel(a, 0), qt.IsTrue)
+	c.Check(a.requestState.Requests.IsEmpty(), qt.IsTrue)
+	c.Check(b.requestState.Requests.IsEmpty(), qt.IsTrue)
+	noRequests()
+
+	// Cancelling a request cancels the duplicates too.
+	requestFromBoth(1)
+	c.Check(tt.cancelRequest(1), qt.Equals, &a.Peer)
+	c.Check(sentCancel(a, 1), qt.IsTrue)
+	c.Check(sentCancel(b, 1), qt.IsTrue)
+	noRequests()
+
+	// A peer stealing a request that's no longer late takes it from all the requesters.
+	requestFromBoth(2)
+	tt.pieceDeadlines[2] = pieceDeadline{at: time.Now().Add(time.Hour)}
+	thief := newPeer()
+	var next desiredRequestState
+	next.Interested = true
+	next.Requests.requestIndexes = []RequestIndex{2}
+	thief.applyRequestState(next)
+	c.Check(sentCancel(a, 2), qt.IsTrue)
+	c.Check(sentCancel(b, 2), qt.IsTrue)
+	c.Check(tt.requestingPeer(2), qt.Equals, &thief.Peer)
+	c.Check(tt.duplicateRequests, qt.HasLen, 0)
+}
+
+// Waits for the initial piece checks, so pieces are eligible for requests.
+func waitForPieceChecks(t *Torrent) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	for !t.piecesQueuedForHash.IsEmpty() || t.activePieceHashes != 0 {
+		t.cl.event.Wait()
+	}
+}
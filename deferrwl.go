@@ -15,14 +15,19 @@ func (me *lockWithDeferreds) Lock() {
 }
 
 func (me *lockWithDeferreds) Unlock() {
-	unlockActions := me.unlockActions
-	for i := 0; i < len(unlockActions); i += 1 {
-		unlockActions[i]()
-	}
-	me.unlockActions = unlockActions[:0]
+	me.runUnlockActions()
 	me.internal.Unlock()
 }
 
+// Runs the deferred actions without releasing the lock.
+func (me *lockWithDeferreds) runUnlockActions() {
+	// Actions may defer further actions, so the length is checked on every iteration.
+	for i := 0; i < len(me.unlockActions); i += 1 {
+		me.unlockActions[i]()
+	}
+	me.unlockActions = me.unlockActions[:0]
+}
+
 func (me *lockWithDeferreds) RLock() {
 	me.internal.RLock()
 }
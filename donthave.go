@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// Retracts a Have we sent for the piece with BEP 54, if the peer supports it. Otherwise the peer
+// keeps thinking we have it.
+func (cn *PeerConn) dontHave(piece pieceIndex) {
+	if !cn.sentHaves.Get(bitmap.BitIndex(piece)) {
+		return
+	}
+	id, ok := cn.PeerExtensionIDs[pp.ExtensionNameDontHave]
+	if !ok || id == pp.ExtensionDeleteNumber {
+		return
+	}
+	cn.write(pp.Message{
+		Type:            pp.Extended,
+		ExtendedID:      id,
+		ExtendedPayload: binary.BigEndian.AppendUint32(nil, uint32(piece)),
+	})
+	cn.sentHaves.Remove(bitmap.BitIndex(piece))
+}
+
+func (cn *PeerConn) onReadDontHave(payload []byte) error {
+	if len(payload) != 4 {
+		return fmt.Errorf("unexpected lt_donthave payload length %v", len(payload))
+	}
+	return cn.peerSentDontHave(pieceIndex(binary.BigEndian.Uint32(payload)))
+}
+
+// Retracts a Have from the peer, per BEP 54.
+func (cn *PeerConn) peerSentDontHave(piece pieceIndex) error {
+	t := cn.t
+	if t.haveInfo() && piece >= t.numPieces() || piece < 0 {
+		return errors.New("invalid piece")
+	}
+	if cn.peerSentHaveAll {
+		if !t.haveInfo() {
+			// We can't represent all but one piece until we know how many there are.
+			return nil
+		}
+		// Switch to tracking the peer's pieces individually.
+		t.deleteConnWithAllPieces(&cn.Peer)
+		cn.peerSentHaveAll = false
+		cn._peerPieces.AddRange(0, uint64(t.numPieces()))
+		cn._peerPieces.Iterate(func(x uint32) bool {
+			t.incPieceAvailability(pieceIndex(x))
+			return true
+		})
+	}
+	if !cn.peerHasPiece(piece) {
+		return nil
+	}
+	cn._peerPieces.Remove(uint32(piece))
+	t.decPieceAvailability(piece)
+	if t.wantPieceIndex(piece) {
+		cn.updateRequests("donthave")
+	}
+	cn.peerPiecesChanged()
+	return nil
+}
@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func newDontHaveTestConn(c *qt.C) (*Torrent, *PeerConn) {
+	cl := newTestingClient(c)
+	tt := cl.newTorrentForTesting()
+	c.Assert(tt.setInfo(&metainfo.Info{
+		PieceLength: 1,
+		Length:      3,
+		Pieces:      make([]byte, pieceHash.Size()*3),
+	}), qt.IsNil)
+	tt.onSetInfo()
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.setTorrent(tt)
+	pc.initMessageWriter()
+	tt.conns[pc] = struct{}{}
+	return tt, pc
+}
+
+func TestSendDontHave(t *testing.T) {
+	c := qt.New(t)
+	tt, pc := newDontHaveTestConn(c)
+	tt.cl.lock()
+	defer tt.cl.unlock()
+	pc.sentHaves.Add(bitmap.BitIndex(1))
+	// The peer doesn't support it.
+	tt.onIncompletePiece(1)
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 0)
+	pc.PeerExtensionIDs = map[pp.ExtensionName]pp.ExtensionNumber{pp.ExtensionNameDontHave: 3}
+	tt.onIncompletePiece(1)
+	c.Check(pc.messageWriter.writeBuffer.String(), qt.Equals, string(pp.Message{
+		Type:            pp.Extended,
+		ExtendedID:      3,
+		ExtendedPayload: []byte{0, 0, 0, 1},
+	}.MustMarshalBinary()))
+	c.Check(pc.sentHaves.Get(bitmap.BitIndex(1)), qt.IsFalse)
+	// Only pieces we said we had are retracted.
+	pc.messageWriter.writeBuffer.Reset()
+	tt.onIncompletePiece(1)
+	tt.onIncompletePiece(2)
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 0)
+}
+
+func TestReceiveDontHave(t *testing.T) {
+	c := qt.New(t)
+	tt, pc := newDontHaveTestConn(c)
+	tt.cl.lock()
+	defer tt.cl.unlock()
+	availability := func() (ret []int) {
+		for i := range tt.numPieces() {
+			ret = append(ret, tt.piece(i).availability())
+		}
+		return
+	}
+	c.Assert(pc.onPeerSentHaveAll(), qt.IsNil)
+	c.Check(availability(), qt.DeepEquals, []int{1, 1, 1})
+	c.Assert(pc.onReadDontHave([]byte{0, 0, 0, 1}), qt.IsNil)
+	c.Check(pc.peerSentHaveAll, qt.IsFalse)
+	c.Check(pc.peerPieces().ToArray(), qt.DeepEquals, []uint32{0, 2})
+	c.Check(availability(), qt.DeepEquals, []int{1, 0, 1})
+	c.Assert(pc.onReadDontHave([]byte{0, 0, 0, 1}), qt.IsNil)
+	c.Check(availability(), qt.DeepEquals, []int{1, 0, 1})
+	c.Assert(pc.peerSentHave(1), qt.IsNil)
+	c.Check(availability(), qt.DeepEquals, []int{1, 1, 1})
+	c.Check(pc.onReadDontHave([]byte{0, 0, 0, 3}), qt.IsNotNil)
+	c.Check(pc.onReadDontHave([]byte{0, 1}), qt.IsNotNil)
+}
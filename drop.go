@@ -0,0 +1,51 @@
+package torrent
+
+import (
+	"errors"
+
+	"github.com/anacrolix/sync"
+)
+
+// Options for Torrent.DropWithOptions.
+type DropOpts struct {
+	// Remove the data the storage wrote for the Torrent, and directories left empty. Nothing outside
+	// the Torrent's directory is touched.
+	DeleteData bool
+	// Forget which pieces are complete, so the data is checked again if the Torrent is re-added.
+	DeletePieceCompletion bool
+}
+
+// Drops the Torrent like Drop, and then deletes what opts asks for once the storage is closed. The
+// storage must support each deletion requested, as the file and mmap storages do.
+func (t *Torrent) DropWithOptions(opts DropOpts) error {
+	var wg sync.WaitGroup
+	t.cl.lock()
+	err := t.cl.dropTorrent(t, &wg)
+	st := t.storage
+	t.cl.unlock()
+	// The storage is closed asynchronously.
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		// There was no info, so nothing was stored.
+		return nil
+	}
+	var errs []error
+	if opts.DeleteData {
+		if st.DeleteData == nil {
+			errs = append(errs, errors.New("torrent storage does not support deleting data"))
+		} else if err := st.DeleteData(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if opts.DeletePieceCompletion {
+		if st.DeletePieceCompletion == nil {
+			errs = append(errs, errors.New("torrent storage does not support deleting piece completion"))
+		} else if err := st.DeletePieceCompletion(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,52 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestDropWithOptionsDeletesData(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	unrelated := filepath.Join(dir, "unrelated")
+	c.Assert(os.WriteFile(unrelated, nil, 0o666), qt.IsNil)
+	pc := storage.NewMapPieceCompletion()
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: pc,
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Assert(tt.Complete.Bool(), qt.IsTrue)
+	pk := metainfo.PieceKey{InfoHash: tt.InfoHash(), Index: 0}
+	compl, err := pc.Get(pk)
+	c.Assert(err, qt.IsNil)
+	c.Assert(compl.Ok, qt.IsTrue)
+
+	c.Assert(tt.DropWithOptions(DropOpts{
+		DeleteData:            true,
+		DeletePieceCompletion: true,
+	}), qt.IsNil)
+	c.Check(cl.Torrents(), qt.HasLen, 0)
+	_, err = os.Stat(filepath.Join(dir, testutil.GreetingFileName))
+	c.Check(os.IsNotExist(err), qt.IsTrue)
+	_, err = os.Stat(unrelated)
+	c.Check(err, qt.IsNil)
+	compl, err = pc.Get(pk)
+	c.Assert(err, qt.IsNil)
+	c.Check(compl.Ok, qt.IsFalse)
+	c.Check(tt.DropWithOptions(DropOpts{}), qt.IsNotNil)
+}
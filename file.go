@@ -20,6 +20,7 @@ type File struct {
 	displayPath string
 	prio        piecePriority
 	piecesRoot  g.Option[[sha256.Size]byte]
+	sequential  bool
 }
 
 func (f *File) String() string {
@@ -42,6 +43,8 @@ func (f *File) FileInfo() metainfo.FileInfo {
 
 // The file's path components joined by '/'.
 func (f *File) Path() string {
+	f.t.nameMu.RLock()
+	defer f.t.nameMu.RUnlock()
 	return f.path
 }
 
@@ -125,8 +128,10 @@ func (f *File) bytesLeft() (left int64) {
 }
 
 // The relative file path for a multi-file torrent, and the torrent name for a
-// single-file torrent. Dir separators are '/'.
+// single-file torrent. Dir separators are '/'. This changes if the file is renamed, see Rename.
 func (f *File) DisplayPath() string {
+	f.t.nameMu.RLock()
+	defer f.t.nameMu.RUnlock()
 	return f.displayPath
 }
 
@@ -58,6 +58,20 @@ func (h *Hash) Sum(b []byte) []byte {
 	return append(b, sum[:]...)
 }
 
+// Like Sum, but the leaves are padded with zero hashes to cover at least length bytes. This gives
+// the hash of a partial piece in a BitTorrent v2 piece layer.
+func (h *Hash) SumMinLength(b []byte, length int) []byte {
+	blocks := h.blocks
+	if h.written != 0 {
+		blocks = append(blocks, h.nextBlockSum())
+	}
+	for len(blocks)*BlockSize < length {
+		blocks = append(blocks, [32]byte{})
+	}
+	sum := RootWithPadHash(blocks, [32]byte{})
+	return append(b, sum[:]...)
+}
+
 func (h *Hash) Reset() {
 	h.blocks = h.blocks[:0]
 	h.nextBlock.Reset()
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"math/bits"
+	"slices"
 
 	g "github.com/anacrolix/generics"
 )
@@ -22,21 +23,43 @@ func Root(hashes [][sha256.Size]byte) [sha256.Size]byte {
 	if numHashes != RoundUpToPowerOfTwo(uint(len(hashes))) {
 		panic(fmt.Sprintf("expected power of two number of hashes, got %d", numHashes))
 	}
-	var next [][sha256.Size]byte
+	return Root(parentLayer(hashes))
+}
+
+// Hashes each pair of nodes in a layer with a power of two length.
+func parentLayer(hashes [][sha256.Size]byte) (next [][sha256.Size]byte) {
+	next = make([][sha256.Size]byte, 0, len(hashes)/2)
 	for i := 0; i < len(hashes); i += 2 {
 		left := hashes[i]
 		right := hashes[i+1]
 		h := sha256.Sum256(append(left[:], right[:]...))
 		next = append(next, h)
 	}
-	return Root(next)
+	return
 }
 
-func RootWithPadHash(hashes [][sha256.Size]byte, padHash [sha256.Size]byte) [sha256.Size]byte {
+func padToPowerOfTwo(hashes [][sha256.Size]byte, padHash [sha256.Size]byte) [][sha256.Size]byte {
 	for uint(len(hashes)) < RoundUpToPowerOfTwo(uint(len(hashes))) {
 		hashes = append(hashes, padHash)
 	}
-	return Root(hashes)
+	return hashes
+}
+
+func RootWithPadHash(hashes [][sha256.Size]byte, padHash [sha256.Size]byte) [sha256.Size]byte {
+	return Root(padToPowerOfTwo(hashes, padHash))
+}
+
+// Returns every layer of the Merkle tree over hashes, which are padded to a power of two with
+// padHash. The first layer is the padded hashes, and the last is the root. hashes must not be
+// empty.
+func LayersWithPadHash(hashes [][sha256.Size]byte, padHash [sha256.Size]byte) (layers [][][sha256.Size]byte) {
+	layer := padToPowerOfTwo(slices.Clone(hashes), padHash)
+	layers = append(layers, layer)
+	for len(layer) > 1 {
+		layer = parentLayer(layer)
+		layers = append(layers, layer)
+	}
+	return
 }
 
 func CompactLayerToSliceHashes(compactLayer string) (hashes [][sha256.Size]byte, err error) {
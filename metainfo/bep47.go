@@ -1,8 +1,25 @@
 package metainfo
 
+import (
+	"strings"
+)
+
 // See BEP 47. This is common to both Info and FileInfo.
 type ExtendedFileAttrs struct {
 	Attr        string   `bencode:"attr,omitempty"`
 	SymlinkPath []string `bencode:"symlink path,omitempty"`
 	Sha1        string   `bencode:"sha1,omitempty"`
 }
+
+// BEP 47 file attributes, as they appear in ExtendedFileAttrs.Attr.
+const (
+	FileAttrPad        = 'p'
+	FileAttrExecutable = 'x'
+	FileAttrHidden     = 'h'
+	// The file is a symlink to ExtendedFileAttrs.SymlinkPath, relative to the torrent root.
+	FileAttrSymlink = 'l'
+)
+
+func (me ExtendedFileAttrs) HasAttr(attr rune) bool {
+	return strings.ContainsRune(me.Attr, attr)
+}
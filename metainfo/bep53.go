@@ -0,0 +1,65 @@
+package metainfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// An inclusive range of file indexes, in the order of the info's files. See BEP 53.
+type FileIndexRange struct {
+	First, Last int
+}
+
+func (r FileIndexRange) Contains(i int) bool {
+	return i >= r.First && i <= r.Last
+}
+
+func (r FileIndexRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// Parses a BEP 53 "so" magnet link value, like "0,2,4,6-8".
+func ParseSelectOnly(s string) (ranges []FileIndexRange, err error) {
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		var r FileIndexRange
+		r.First, err = parseFileIndex(first)
+		if err != nil {
+			return
+		}
+		r.Last = r.First
+		if isRange {
+			r.Last, err = parseFileIndex(last)
+			if err != nil {
+				return
+			}
+			if r.Last < r.First {
+				err = fmt.Errorf("bad file index range %q", part)
+				return
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return
+}
+
+func parseFileIndex(s string) (int, error) {
+	i, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("parsing file index: %w", err)
+	}
+	return int(i), nil
+}
+
+// Formats ranges as a BEP 53 "so" magnet link value.
+func FormatSelectOnly(ranges []FileIndexRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
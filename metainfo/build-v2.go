@@ -0,0 +1,201 @@
+package metainfo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/anacrolix/torrent/merkle"
+)
+
+const padFileAttr = string(FileAttrPad)
+
+// A file found when building an Info from the file system.
+type buildFile struct {
+	// Relative to the root, nil if the root is the file.
+	path   []string
+	length int64
+	attrs  ExtendedFileAttrs
+}
+
+// Sets the info to a BitTorrent v2 (BEP 52) description of the files at root, and returns the piece
+// layers for MetaInfo.PieceLayers. The piece length is chosen if it's zero, and must be a power of
+// two of at least 16 KiB.
+func (info *Info) BuildFromFilePathV2(root string) (pieceLayers map[string]string, err error) {
+	return info.buildFromFilePathV2(root, false)
+}
+
+// Like BuildFromFilePathV2, but the info also describes the files for BitTorrent v1, with BEP 47
+// pad files aligning each file to a piece boundary so v1 and v2 peers share the same pieces.
+func (info *Info) BuildFromFilePathHybrid(root string) (pieceLayers map[string]string, err error) {
+	return info.buildFromFilePathV2(root, true)
+}
+
+func (info *Info) buildFromFilePathV2(root string, hybrid bool) (pieceLayers map[string]string, err error) {
+	files, err := new(Builder).walkFiles(root)
+	if err != nil {
+		return
+	}
+	err = info.resetForV2Build(root, files, hybrid)
+	if err != nil {
+		return
+	}
+	open := func(path []string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(append([]string{root}, path...)...))
+	}
+	if hybrid {
+		err = info.GeneratePieces(func(fi FileInfo) (io.ReadCloser, error) {
+			if fi.Attr == padFileAttr {
+				return io.NopCloser(io.LimitReader(zeroReader{}, fi.Length)), nil
+			}
+			return open(fi.Path)
+		})
+		if err != nil {
+			err = fmt.Errorf("generating v1 pieces: %w", err)
+			return
+		}
+	}
+	pieceLayers = make(map[string]string)
+	for _, f := range files {
+		var ftf FileTreeFile
+		ftf, err = hashFileV2(open, f, info.PieceLength, pieceLayers)
+		if err != nil {
+			return
+		}
+		info.addFileTreeFile(f, ftf)
+	}
+	info.MetaVersion = 2
+	return
+}
+
+// Sets the fields common to v2 and hybrid infos before hashing, and the v1 files for hybrid.
+func (info *Info) resetForV2Build(root string, files []buildFile, hybrid bool) error {
+	var totalLength int64
+	for _, f := range files {
+		totalLength += f.length
+	}
+	if info.PieceLength == 0 {
+		info.PieceLength = ChoosePieceLength(totalLength)
+	}
+	if info.PieceLength < merkle.BlockSize || info.PieceLength&(info.PieceLength-1) != 0 {
+		return fmt.Errorf("piece length %v is not a power of two of at least %v", info.PieceLength, merkle.BlockSize)
+	}
+	info.Name = infoNameForRoot(root)
+	info.Length = 0
+	info.ExtendedFileAttrs = ExtendedFileAttrs{}
+	info.Files = nil
+	info.Pieces = nil
+	info.MetaVersion = 0
+	info.FileTree = FileTree{}
+	if hybrid {
+		info.setHybridFiles(files)
+	}
+	return nil
+}
+
+func (info *Info) addFileTreeFile(f buildFile, ftf FileTreeFile) {
+	ftf.Attr = f.attrs.Attr
+	ftf.SymlinkPath = f.attrs.SymlinkPath
+	path := f.path
+	if path == nil {
+		// The root is a file. The file tree still needs a name for it.
+		path = []string{info.Name}
+	}
+	info.FileTree.add(path, ftf)
+}
+
+// Sets the v1 files, with pad files after every file but the last that doesn't end on a piece
+// boundary.
+func (info *Info) setHybridFiles(files []buildFile) {
+	if len(files) == 1 && files[0].path == nil {
+		info.Length = files[0].length
+		info.ExtendedFileAttrs = files[0].attrs
+		return
+	}
+	for i, f := range files {
+		info.Files = append(info.Files, FileInfo{
+			Path:              f.path,
+			Length:            f.length,
+			ExtendedFileAttrs: f.attrs,
+		})
+		if i == len(files)-1 {
+			break
+		}
+		if pad := (info.PieceLength - f.length%info.PieceLength) % info.PieceLength; pad != 0 {
+			info.Files = append(info.Files, FileInfo{
+				Path:              []string{".pad", strconv.FormatInt(pad, 10)},
+				Length:            pad,
+				ExtendedFileAttrs: ExtendedFileAttrs{Attr: padFileAttr},
+			})
+		}
+	}
+}
+
+// Hashes the file for the v2 file tree, adding its piece layer if it has more than one piece.
+func hashFileV2(
+	open func(path []string) (io.ReadCloser, error),
+	f buildFile,
+	pieceLength int64,
+	pieceLayers map[string]string,
+) (ftf FileTreeFile, err error) {
+	ftf.Length = f.length
+	if f.length == 0 {
+		return
+	}
+	r, err := open(f.path)
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	h := merkle.NewHash()
+	var layer []byte
+	for off := int64(0); off < f.length; off += pieceLength {
+		h.Reset()
+		_, err = io.CopyN(h, r, min(pieceLength, f.length-off))
+		if err != nil {
+			err = fmt.Errorf("hashing %q: %w", f.path, err)
+			return
+		}
+		layer = h.SumMinLength(layer, int(pieceLength))
+	}
+	if f.length <= pieceLength {
+		// The pieces root covers only the file's blocks.
+		ftf.PiecesRoot = string(h.Sum(nil))
+		return
+	}
+	ftf.PiecesRoot, err = addPieceLayer(pieceLayers, layer, pieceLength)
+	return
+}
+
+// Adds the piece layer for a file with more than one piece, and returns its pieces root.
+func addPieceLayer(pieceLayers map[string]string, layer []byte, pieceLength int64) (string, error) {
+	hashes, err := merkle.CompactLayerToSliceHashes(string(layer))
+	if err != nil {
+		return "", err
+	}
+	root := merkle.RootWithPadHash(hashes, HashForPiecePad(pieceLength))
+	pieceLayers[string(root[:])] = string(layer)
+	return string(root[:]), nil
+}
+
+func (ft *FileTree) add(path []string, ftf FileTreeFile) {
+	if len(path) == 0 {
+		ft.File = ftf
+		return
+	}
+	if ft.Dir == nil {
+		ft.Dir = make(map[string]FileTree)
+	}
+	sub := ft.Dir[path[0]]
+	sub.add(path[1:], ftf)
+	ft.Dir[path[0]] = sub
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
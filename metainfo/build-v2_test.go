@@ -0,0 +1,111 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/merkle"
+)
+
+const buildTestPieceLength = 32 << 10
+
+func writeBuildTestFiles(c *qt.C) (root string, contents map[string][]byte) {
+	root = filepath.Join(c.TempDir(), "root")
+	contents = map[string][]byte{
+		"a":   make([]byte, 40000),
+		"b/c": nil,
+		"b/d": make([]byte, 100000),
+	}
+	rand.New(rand.NewSource(1)).Read(contents["a"])
+	rand.New(rand.NewSource(2)).Read(contents["b/d"])
+	for name, b := range contents {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0o777), qt.IsNil)
+		c.Assert(os.WriteFile(path, b, 0o666), qt.IsNil)
+	}
+	return
+}
+
+func checkV2Info(c *qt.C, info *Info, pieceLayers map[string]string) {
+	c.Assert(info.HasV2(), qt.IsTrue)
+	c.Check(ValidatePieceLayers(pieceLayers, &info.FileTree, info.PieceLength), qt.IsNil)
+	// The empty file has no pieces.
+	c.Check(pieceLayers, qt.HasLen, 2)
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	var decoded Info
+	c.Assert(bencode.Unmarshal(b, &decoded), qt.IsNil)
+	b2, err := bencode.Marshal(decoded)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b2), qt.Equals, string(b))
+	var lengths []int64
+	for _, fi := range decoded.UpvertedFiles() {
+		lengths = append(lengths, fi.Length)
+	}
+	c.Check(lengths, qt.DeepEquals, []int64{40000, 0, 100000})
+	c.Check(decoded.NumPieces(), qt.Equals, 2+4)
+}
+
+func TestBuildFromFilePathV2(t *testing.T) {
+	c := qt.New(t)
+	root, contents := writeBuildTestFiles(c)
+	info := Info{PieceLength: buildTestPieceLength}
+	pieceLayers, err := info.BuildFromFilePathV2(root)
+	c.Assert(err, qt.IsNil)
+	checkV2Info(c, &info, pieceLayers)
+	c.Check(info.HasV1(), qt.IsFalse)
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	c.Check(bytes.Contains(b, []byte("6:pieces")), qt.IsFalse)
+	// The pieces root is the root of the file's block hashes.
+	h := merkle.NewHash()
+	h.Write(contents["a"])
+	c.Check(info.FileTree.Dir["a"].File.PiecesRoot, qt.Equals, string(h.Sum(nil)))
+
+	info = Info{PieceLength: 3 << 14}
+	_, err = info.BuildFromFilePathV2(root)
+	c.Check(err, qt.IsNotNil)
+}
+
+func TestBuildFromFilePathHybrid(t *testing.T) {
+	c := qt.New(t)
+	root, contents := writeBuildTestFiles(c)
+	info := Info{PieceLength: buildTestPieceLength}
+	pieceLayers, err := info.BuildFromFilePathHybrid(root)
+	c.Assert(err, qt.IsNil)
+	checkV2Info(c, &info, pieceLayers)
+	c.Assert(info.HasV1(), qt.IsTrue)
+	c.Check(info.Files, qt.DeepEquals, []FileInfo{
+		{Path: []string{"a"}, Length: 40000},
+		{Path: []string{".pad", "25536"}, Length: 25536, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "p"}},
+		{Path: []string{"b", "c"}},
+		{Path: []string{"b", "d"}, Length: 100000},
+	})
+	// The v1 pieces line up with the v2 pieces.
+	c.Assert(len(info.Pieces)/sha1.Size, qt.Equals, info.NumPieces())
+	lastOfA := sha1.Sum(append(bytes.Clone(contents["a"][buildTestPieceLength:]), make([]byte, 25536)...))
+	c.Check(info.Pieces[sha1.Size:2*sha1.Size], qt.DeepEquals, lastOfA[:])
+	firstOfD := sha1.Sum(contents["b/d"][:buildTestPieceLength])
+	c.Check(info.Pieces[2*sha1.Size:3*sha1.Size], qt.DeepEquals, firstOfD[:])
+}
+
+func TestBuildFromFilePathV2SingleFile(t *testing.T) {
+	c := qt.New(t)
+	root, _ := writeBuildTestFiles(c)
+	info := Info{PieceLength: buildTestPieceLength}
+	pieceLayers, err := info.BuildFromFilePathHybrid(filepath.Join(root, "b", "d"))
+	c.Assert(err, qt.IsNil)
+	c.Check(info.Name, qt.Equals, "d")
+	c.Check(info.Length, qt.Equals, int64(100000))
+	c.Check(info.Files, qt.IsNil)
+	c.Check(info.FileTree.Dir["d"].File.Length, qt.Equals, int64(100000))
+	c.Check(ValidatePieceLayers(pieceLayers, &info.FileTree, info.PieceLength), qt.IsNil)
+	c.Check(len(info.Pieces)/sha1.Size, qt.Equals, info.NumPieces())
+}
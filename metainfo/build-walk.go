@@ -0,0 +1,197 @@
+package metainfo
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// How a Builder handles symlinks.
+type SymlinkMode int
+
+const (
+	// The files and directories symlinks point to are included as though they were at the symlink.
+	FollowSymlinks SymlinkMode = iota
+	// Symlinks are recorded with the BEP 47 symlink attribute. They must point within the root.
+	RecordSymlinks
+)
+
+type buildWalker struct {
+	*Builder
+	root  string
+	files []buildFile
+}
+
+// Returns the files beneath root, in the order of a v2 file tree.
+func (b *Builder) walkFiles(root string) (files []buildFile, err error) {
+	for _, pattern := range slices.Concat(b.Include, b.Exclude) {
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			err = fmt.Errorf("pattern %q: %w", pattern, err)
+			return
+		}
+	}
+	w := buildWalker{
+		Builder: b,
+		root:    root,
+	}
+	err = w.walk(root, nil, nil, len(b.Include) == 0)
+	if err != nil {
+		return
+	}
+	files = w.files
+	slices.SortFunc(files, func(a, b buildFile) int {
+		return slices.Compare(a.path, b.path)
+	})
+	return
+}
+
+// Adds the files at name, which is at relPath from the root. dirs are the resolved directories
+// being walked, to catch symlink loops. included is whether a directory above matched Include.
+func (w *buildWalker) walk(name string, relPath []string, dirs []string, included bool) error {
+	fi, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		if w.Symlinks == RecordSymlinks && relPath != nil {
+			if !w.includeFile(relPath, included) {
+				return nil
+			}
+			return w.addSymlink(name, relPath, fi)
+		}
+		fi, err = os.Stat(name)
+		if err != nil {
+			return err
+		}
+	}
+	if fi.IsDir() {
+		return w.walkDir(name, relPath, dirs, included)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	if relPath != nil && !w.includeFile(relPath, included) {
+		return nil
+	}
+	w.files = append(w.files, buildFile{
+		path:   relPath,
+		length: fi.Size(),
+		attrs:  ExtendedFileAttrs{Attr: w.fileAttr(name, fi)},
+	})
+	return nil
+}
+
+func (w *buildWalker) walkDir(name string, relPath []string, dirs []string, included bool) error {
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(dirs, resolved) {
+		return fmt.Errorf("symlink loop at %q", name)
+	}
+	if relPath != nil {
+		if patternsMatch(w.Exclude, relPath, true) {
+			return nil
+		}
+		included = included || patternsMatch(w.Include, relPath, true)
+	}
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	dirs = append(dirs, resolved)
+	for _, e := range entries {
+		err = w.walk(
+			filepath.Join(name, e.Name()),
+			append(slices.Clip(relPath), e.Name()),
+			slices.Clip(dirs),
+			included,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *buildWalker) includeFile(relPath []string, included bool) bool {
+	if patternsMatch(w.Exclude, relPath, false) {
+		return false
+	}
+	return included || patternsMatch(w.Include, relPath, false)
+}
+
+func (w *buildWalker) addSymlink(name string, relPath []string, fi os.FileInfo) error {
+	target, err := os.Readlink(name)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(name), target)
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(w.root)
+	if err != nil {
+		return err
+	}
+	targetRelPath, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	if targetRelPath == "." || targetRelPath == ".." ||
+		strings.HasPrefix(targetRelPath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink %q points outside the root", name)
+	}
+	w.files = append(w.files, buildFile{
+		path: relPath,
+		attrs: ExtendedFileAttrs{
+			Attr:        w.fileAttr(name, fi),
+			SymlinkPath: strings.Split(targetRelPath, string(filepath.Separator)),
+		},
+	})
+	return nil
+}
+
+// The BEP 47 attributes for the file.
+func (w *buildWalker) fileAttr(name string, fi os.FileInfo) (attr string) {
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		attr += string(FileAttrSymlink)
+	}
+	if !w.FileAttrs {
+		return
+	}
+	if fi.Mode().IsRegular() && fi.Mode()&0o111 != 0 {
+		attr += string(FileAttrExecutable)
+	}
+	if strings.HasPrefix(filepath.Base(name), ".") {
+		attr += string(FileAttrHidden)
+	}
+	return
+}
+
+// Whether any of the patterns match the file or directory at relPath. See Builder.Exclude.
+func patternsMatch(patterns []string, relPath []string, isDir bool) bool {
+	for _, pattern := range patterns {
+		pattern, dirOnly := strings.CutSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		name := relPath[len(relPath)-1]
+		if anchored, ok := strings.CutPrefix(pattern, "/"); ok || strings.Contains(pattern, "/") {
+			pattern = anchored
+			name = strings.Join(relPath, "/")
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package metainfo
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/anacrolix/torrent/merkle"
+)
+
+// The BitTorrent versions a Builder describes files for.
+type BuildVersion int
+
+const (
+	// Like Info.BuildFromFilePath.
+	BuildV1 BuildVersion = iota
+	// Like Info.BuildFromFilePathV2.
+	BuildV2
+	// Like Info.BuildFromFilePathHybrid.
+	BuildHybrid
+)
+
+type BuildProgress struct {
+	FilesDone   int
+	FilesTotal  int
+	BytesDone   int64
+	BytesTotal  int64
+	PiecesDone  int
+	PiecesTotal int
+}
+
+// Builds an Info from the file system, hashing pieces concurrently. With the default file options,
+// the result for regular files is the same as the corresponding Info.BuildFromFilePath* method.
+type Builder struct {
+	Version BuildVersion
+	// The number of pieces hashed at once. Defaults to GOMAXPROCS.
+	Workers int
+	// Called as pieces are hashed. It's never called concurrently.
+	Progress func(BuildProgress)
+	// Record the BEP 47 executable and hidden (dot file) attributes.
+	FileAttrs bool
+	Symlinks  SymlinkMode
+	// Glob patterns (see path.Match) for files to include and exclude. Patterns match the file
+	// name, or the slash-separated path from the root if they contain a slash. A trailing slash
+	// matches only directories, and applies to everything beneath them. If Include is set, only
+	// files matching it are included. Exclude takes precedence.
+	Include []string
+	Exclude []string
+}
+
+// A piece to be hashed, and where its data comes from.
+type builderPiece struct {
+	index    int
+	segments []builderSegment
+	// Zeroes following the data in the v1 piece, for hybrid pieces followed by a pad file.
+	v1Pad int64
+	// The file the piece belongs to for v2, and whether it's the only piece of that file.
+	file    int
+	onlyV2  bool
+	v2Piece bool
+}
+
+type builderSegment struct {
+	file   int
+	offset int64
+	length int64
+}
+
+// The hashes of a builderPiece.
+type builderPieceHashes struct {
+	v1 [sha1.Size]byte
+	v2 [32]byte
+	// The pieces root, for the only piece of a v2 file.
+	root [32]byte
+}
+
+type builder struct {
+	*Builder
+	root        string
+	files       []buildFile
+	pieceLength int64
+	pieces      []builderPiece
+	hashes      []builderPieceHashes
+	v1          bool
+	v2          bool
+	mu          sync.Mutex
+	progress    BuildProgress
+	// Pieces remaining for each file to be done.
+	filePiecesLeft []int
+}
+
+// Sets the info to describe the files at root, and returns the piece layers for
+// MetaInfo.PieceLayers if the Version includes v2. Cancelling ctx stops hashing.
+func (b *Builder) BuildFromFilePath(ctx context.Context, info *Info, root string) (pieceLayers map[string]string, err error) {
+	files, err := b.walkFiles(root)
+	if err != nil {
+		return
+	}
+	me := builder{
+		Builder: b,
+		root:    root,
+		files:   files,
+	}
+	switch b.Version {
+	case BuildV1:
+		me.v1 = true
+		// The same order as Info.BuildFromFilePath.
+		slices.SortFunc(me.files, func(l, r buildFile) int {
+			return strings.Compare(strings.Join(l.path, "/"), strings.Join(r.path, "/"))
+		})
+		info.Name = infoNameForRoot(root)
+		info.Files = nil
+		for _, f := range me.files {
+			if f.path == nil {
+				info.Length = f.length
+				info.ExtendedFileAttrs = f.attrs
+			} else {
+				info.Files = append(info.Files, FileInfo{
+					Path:              f.path,
+					Length:            f.length,
+					ExtendedFileAttrs: f.attrs,
+				})
+			}
+		}
+		if info.PieceLength == 0 {
+			info.PieceLength = ChoosePieceLength(info.TotalLength())
+		}
+		me.addV1Pieces(info.PieceLength)
+	case BuildV2, BuildHybrid:
+		me.v1 = b.Version == BuildHybrid
+		me.v2 = true
+		err = info.resetForV2Build(root, files, me.v1)
+		if err != nil {
+			return
+		}
+		me.addV2Pieces(info.PieceLength)
+	default:
+		err = fmt.Errorf("unknown build version %v", b.Version)
+		return
+	}
+	me.pieceLength = info.PieceLength
+	err = me.hashPieces(ctx)
+	if err != nil {
+		return
+	}
+	if me.v1 {
+		info.Pieces = make([]byte, 0, len(me.pieces)*sha1.Size)
+		for _, h := range me.hashes {
+			info.Pieces = append(info.Pieces, h.v1[:]...)
+		}
+	}
+	if me.v2 {
+		pieceLayers, err = me.fileTree(info)
+		info.MetaVersion = 2
+	}
+	return
+}
+
+// Pieces span files, back to back.
+func (me *builder) addV1Pieces(pieceLength int64) {
+	var piece *builderPiece
+	var pieceLeft int64
+	for i, f := range me.files {
+		for off := int64(0); off < f.length; {
+			if pieceLeft == 0 {
+				me.pieces = append(me.pieces, builderPiece{index: len(me.pieces)})
+				piece = &me.pieces[len(me.pieces)-1]
+				pieceLeft = pieceLength
+			}
+			n := min(pieceLeft, f.length-off)
+			piece.segments = append(piece.segments, builderSegment{i, off, n})
+			off += n
+			pieceLeft -= n
+		}
+	}
+}
+
+// Pieces are aligned to the start of each file.
+func (me *builder) addV2Pieces(pieceLength int64) {
+	for i, f := range me.files {
+		for off := int64(0); off < f.length; off += pieceLength {
+			n := min(pieceLength, f.length-off)
+			p := builderPiece{
+				index:    len(me.pieces),
+				segments: []builderSegment{{i, off, n}},
+				file:     i,
+				onlyV2:   f.length <= pieceLength,
+				v2Piece:  true,
+			}
+			// Every file but the last is followed by a pad file.
+			if i != len(me.files)-1 {
+				p.v1Pad = pieceLength - n
+			}
+			me.pieces = append(me.pieces, p)
+		}
+	}
+}
+
+func (me *builder) hashPieces(ctx context.Context) error {
+	me.hashes = make([]builderPieceHashes, len(me.pieces))
+	me.filePiecesLeft = make([]int, len(me.files))
+	for _, p := range me.pieces {
+		for _, s := range p.segments {
+			me.filePiecesLeft[s.file]++
+		}
+	}
+	me.progress.FilesTotal = len(me.files)
+	me.progress.PiecesTotal = len(me.pieces)
+	for i, f := range me.files {
+		me.progress.BytesTotal += f.length
+		if me.filePiecesLeft[i] == 0 {
+			me.progress.FilesDone++
+		}
+	}
+	me.reportProgress()
+	workers := me.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	pieces := make(chan *builderPiece)
+	eg.Go(func() error {
+		defer close(pieces)
+		for i := range me.pieces {
+			select {
+			case pieces <- &me.pieces[i]:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	for range workers {
+		eg.Go(func() error {
+			for p := range pieces {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				err := me.hashPiece(p)
+				if err != nil {
+					return err
+				}
+				me.pieceDone(p)
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
+func (me *builder) hashPiece(p *builderPiece) (err error) {
+	v1 := sha1.New()
+	v2 := merkle.NewHash()
+	var w io.Writer
+	switch {
+	case me.v1 && me.v2:
+		w = io.MultiWriter(v1, v2)
+	case me.v1:
+		w = v1
+	default:
+		w = v2
+	}
+	for _, s := range p.segments {
+		err = me.copySegment(w, s)
+		if err != nil {
+			return
+		}
+	}
+	h := &me.hashes[p.index]
+	if me.v1 {
+		_, err = io.CopyN(v1, zeroReader{}, p.v1Pad)
+		if err != nil {
+			return
+		}
+		v1.Sum(h.v1[:0])
+	}
+	if p.v2Piece {
+		v2.SumMinLength(h.v2[:0], int(me.pieceLength))
+		if p.onlyV2 {
+			v2.Sum(h.root[:0])
+		}
+	}
+	return
+}
+
+func (me *builder) copySegment(w io.Writer, s builderSegment) error {
+	f, err := os.Open(filepath.Join(append([]string{me.root}, me.files[s.file].path...)...))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, io.NewSectionReader(f, s.offset, s.length))
+	if err != nil {
+		return fmt.Errorf("hashing %q: %w", me.files[s.file].path, err)
+	}
+	return nil
+}
+
+func (me *builder) pieceDone(p *builderPiece) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.progress.PiecesDone++
+	for _, s := range p.segments {
+		me.progress.BytesDone += s.length
+		me.filePiecesLeft[s.file]--
+		if me.filePiecesLeft[s.file] == 0 {
+			me.progress.FilesDone++
+		}
+	}
+	me.reportProgress()
+}
+
+func (me *builder) reportProgress() {
+	if me.Progress != nil {
+		me.Progress(me.progress)
+	}
+}
+
+// Sets the file tree from the v2 piece hashes, and returns the piece layers.
+func (me *builder) fileTree(info *Info) (pieceLayers map[string]string, err error) {
+	pieceLayers = make(map[string]string)
+	layers := make([][]byte, len(me.files))
+	roots := make([][32]byte, len(me.files))
+	for _, p := range me.pieces {
+		h := me.hashes[p.index]
+		layers[p.file] = append(layers[p.file], h.v2[:]...)
+		if p.onlyV2 {
+			roots[p.file] = h.root
+		}
+	}
+	for i, f := range me.files {
+		ftf := FileTreeFile{Length: f.length}
+		switch {
+		case f.length == 0:
+		case f.length <= info.PieceLength:
+			ftf.PiecesRoot = string(roots[i][:])
+		default:
+			ftf.PiecesRoot, err = addPieceLayer(pieceLayers, layers[i], info.PieceLength)
+			if err != nil {
+				return
+			}
+		}
+		info.addFileTreeFile(f, ftf)
+	}
+	return
+}
@@ -0,0 +1,144 @@
+package metainfo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestBuilderMatchesSerial(t *testing.T) {
+	c := qt.New(t)
+	root, _ := writeBuildTestFiles(c)
+	for _, root := range []string{root, filepath.Join(root, "b", "d")} {
+		for _, v := range []BuildVersion{BuildV1, BuildV2, BuildHybrid} {
+			c.Run("", func(c *qt.C) {
+				serial := Info{PieceLength: buildTestPieceLength}
+				var serialLayers map[string]string
+				var err error
+				switch v {
+				case BuildV1:
+					err = serial.BuildFromFilePath(root)
+				case BuildV2:
+					serialLayers, err = serial.BuildFromFilePathV2(root)
+				case BuildHybrid:
+					serialLayers, err = serial.BuildFromFilePathHybrid(root)
+				}
+				c.Assert(err, qt.IsNil)
+				var progress []BuildProgress
+				b := Builder{
+					Version: v,
+					Workers: 3,
+					Progress: func(p BuildProgress) {
+						progress = append(progress, p)
+					},
+				}
+				parallel := Info{PieceLength: buildTestPieceLength}
+				layers, err := b.BuildFromFilePath(context.Background(), &parallel, root)
+				c.Assert(err, qt.IsNil)
+				c.Check(layers, qt.DeepEquals, serialLayers)
+				serialBytes, err := bencode.Marshal(serial)
+				c.Assert(err, qt.IsNil)
+				parallelBytes, err := bencode.Marshal(parallel)
+				c.Assert(err, qt.IsNil)
+				c.Check(string(parallelBytes), qt.Equals, string(serialBytes))
+
+				c.Assert(progress, qt.Not(qt.HasLen), 0)
+				last := progress[len(progress)-1]
+				c.Check(last.FilesDone, qt.Equals, last.FilesTotal)
+				c.Check(last.BytesDone, qt.Equals, last.BytesTotal)
+				c.Check(last.BytesTotal, qt.Equals, serial.TotalLength())
+				c.Check(last.PiecesDone, qt.Equals, last.PiecesTotal)
+				c.Check(len(progress), qt.Equals, last.PiecesTotal+1)
+			})
+		}
+	}
+}
+
+func TestBuilderCancelled(t *testing.T) {
+	c := qt.New(t)
+	root, _ := writeBuildTestFiles(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var info Info
+	_, err := (&Builder{Version: BuildHybrid}).BuildFromFilePath(ctx, &info, root)
+	c.Check(err, qt.ErrorIs, context.Canceled)
+}
+
+func writeBuildFileOptionsTestFiles(c *qt.C) (root string) {
+	root = c.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"run.sh":      0o755,
+		".hidden":     0o644,
+		".git/config": 0o644,
+		"x.tmp":       0o644,
+		"sub/f":       0o644,
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		c.Assert(os.MkdirAll(filepath.Dir(name), 0o777), qt.IsNil)
+		c.Assert(os.WriteFile(name, []byte("hello"), mode), qt.IsNil)
+		c.Assert(os.Chmod(name, mode), qt.IsNil)
+	}
+	c.Assert(os.Symlink("run.sh", filepath.Join(root, "link")), qt.IsNil)
+	c.Assert(os.Symlink("sub", filepath.Join(root, "dirlink")), qt.IsNil)
+	return
+}
+
+func TestBuilderFileOptions(t *testing.T) {
+	c := qt.New(t)
+	root := writeBuildFileOptionsTestFiles(c)
+	build := func(b Builder) (files []FileInfo) {
+		var info Info
+		_, err := b.BuildFromFilePath(context.Background(), &info, root)
+		c.Assert(err, qt.IsNil)
+		for _, fi := range info.UpvertedFiles() {
+			files = append(files, FileInfo{
+				Path:              fi.Path,
+				Length:            fi.Length,
+				ExtendedFileAttrs: fi.ExtendedFileAttrs,
+			})
+		}
+		return
+	}
+	c.Check(build(Builder{
+		FileAttrs: true,
+		Symlinks:  RecordSymlinks,
+		Exclude:   []string{".git/", "*.tmp"},
+	}), qt.DeepEquals, []FileInfo{
+		{Path: []string{".hidden"}, Length: 5, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "h"}},
+		{Path: []string{"dirlink"}, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "l", SymlinkPath: []string{"sub"}}},
+		{Path: []string{"link"}, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "l", SymlinkPath: []string{"run.sh"}}},
+		{Path: []string{"run.sh"}, Length: 5, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "x"}},
+		{Path: []string{"sub", "f"}, Length: 5},
+	})
+	// The attributes survive in the v2 file tree.
+	c.Check(build(Builder{
+		Version:   BuildV2,
+		FileAttrs: true,
+		Symlinks:  RecordSymlinks,
+		Include:   []string{"link", "run.sh"},
+	}), qt.DeepEquals, []FileInfo{
+		{Path: []string{"link"}, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "l", SymlinkPath: []string{"run.sh"}}},
+		{Path: []string{"run.sh"}, Length: 5, ExtendedFileAttrs: ExtendedFileAttrs{Attr: "x"}},
+	})
+	// Symlinks are followed by default, and directories can be included by path.
+	c.Check(build(Builder{
+		Include: []string{"dirlink/", "/link"},
+	}), qt.DeepEquals, []FileInfo{
+		{Path: []string{"dirlink", "f"}, Length: 5},
+		{Path: []string{"link"}, Length: 5},
+	})
+
+	var info Info
+	_, err := (&Builder{Exclude: []string{"["}}).BuildFromFilePath(context.Background(), &info, root)
+	c.Check(err, qt.IsNotNil)
+	c.Assert(os.Symlink("..", filepath.Join(root, "sub", "up")), qt.IsNil)
+	_, err = (&Builder{}).BuildFromFilePath(context.Background(), &info, root)
+	c.Check(err, qt.ErrorMatches, "symlink loop.*")
+	_, err = (&Builder{Symlinks: RecordSymlinks}).BuildFromFilePath(context.Background(), &info, root)
+	c.Check(err, qt.ErrorMatches, "symlink .* points outside the root")
+}
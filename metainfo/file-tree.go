@@ -14,6 +14,9 @@ const FileTreePropertiesKey = ""
 type FileTreeFile struct {
 	Length     int64  `bencode:"length"`
 	PiecesRoot string `bencode:"pieces root"`
+	// BEP 47
+	Attr        string   `bencode:"attr,omitempty"`
+	SymlinkPath []string `bencode:"symlink path,omitempty"`
 }
 
 // The fields here don't need bencode tags as the marshalling is done manually.
@@ -49,6 +52,34 @@ func (ft *FileTree) UnmarshalBencode(bytes []byte) (err error) {
 
 var _ bencode.Unmarshaler = (*FileTree)(nil)
 
+func (ft FileTree) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal(ft.bencodeValue())
+}
+
+var _ bencode.Marshaler = FileTree{}
+
+func (ft *FileTree) bencodeValue() map[string]any {
+	if !ft.IsDir() {
+		props := map[string]any{"length": ft.File.Length}
+		if ft.File.Attr != "" {
+			props["attr"] = ft.File.Attr
+		}
+		if len(ft.File.SymlinkPath) != 0 {
+			props["symlink path"] = ft.File.SymlinkPath
+		}
+		// Empty files have no pieces root.
+		if ft.File.PiecesRoot != "" {
+			props["pieces root"] = ft.File.PiecesRoot
+		}
+		return map[string]any{FileTreePropertiesKey: props}
+	}
+	dir := make(map[string]any, len(ft.Dir))
+	for key, sub := range ft.Dir {
+		dir[key] = sub.bencodeValue()
+	}
+	return dir
+}
+
 func (ft *FileTree) NumEntries() (num int) {
 	num = len(ft.Dir)
 	if g.MapContains(ft.Dir, FileTreePropertiesKey) {
@@ -94,6 +125,10 @@ func (ft *FileTree) upvertedFilesInner(
 			PathUtf8:      append([]string(nil), path...),
 			PiecesRoot:    ft.PiecesRootAsByteArray(),
 			TorrentOffset: *offset,
+			ExtendedFileAttrs: ExtendedFileAttrs{
+				Attr:        ft.File.Attr,
+				SymlinkPath: ft.File.SymlinkPath,
+			},
 		})
 		*offset += (ft.File.Length + pieceLength - 1) / pieceLength * pieceLength
 	}
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/anacrolix/missinggo/v2/slices"
+
+	"github.com/anacrolix/torrent/bencode"
 )
 
 // The info dictionary. See BEP 3 and BEP 52.
@@ -29,6 +31,24 @@ type Info struct {
 	FileTree    FileTree `bencode:"file tree,omitempty"`
 }
 
+// Omits the pieces field when the Info is v2-only, which it otherwise always has.
+func (info Info) MarshalBencode() ([]byte, error) {
+	type plainInfo Info
+	b, err := bencode.Marshal(plainInfo(info))
+	if err != nil || info.HasV1() {
+		return b, err
+	}
+	var dict map[string]bencode.Bytes
+	err = bencode.Unmarshal(b, &dict)
+	if err != nil {
+		return nil, err
+	}
+	delete(dict, "pieces")
+	return bencode.Marshal(dict)
+}
+
+var _ bencode.Marshaler = Info{}
+
 // The Info.Name field is "advisory". For multi-file torrents it's usually a suggested directory
 // name. There are situations where we don't want a directory (like using the contents of a torrent
 // as the immediate contents of a directory), or the name is invalid. Transmission will inject the
@@ -41,15 +61,7 @@ const NoName = "-"
 
 // This is a helper that sets Files and Pieces from a root path and its children.
 func (info *Info) BuildFromFilePath(root string) (err error) {
-	info.Name = func() string {
-		b := filepath.Base(root)
-		switch b {
-		case ".", "..", string(filepath.Separator):
-			return NoName
-		default:
-			return b
-		}
-	}()
+	info.Name = infoNameForRoot(root)
 	info.Files = nil
 	err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
@@ -91,6 +103,17 @@ func (info *Info) BuildFromFilePath(root string) (err error) {
 	return
 }
 
+// The info name for the files at root.
+func infoNameForRoot(root string) string {
+	b := filepath.Base(root)
+	switch b {
+	case ".", "..", string(filepath.Separator):
+		return NoName
+	default:
+		return b
+	}
+}
+
 // Concatenates all the files in the torrent into w. open is a function that
 // gets at the contents of the given file.
 func (info *Info) writeFiles(w io.Writer, open func(fi FileInfo) (io.ReadCloser, error)) error {
@@ -165,7 +188,8 @@ func (info *Info) UpvertedFiles() (files []FileInfo) {
 			Length: info.Length,
 			// Callers should determine that Info.Name is the basename, and
 			// thus a regular file.
-			Path: nil,
+			Path:              nil,
+			ExtendedFileAttrs: info.ExtendedFileAttrs,
 		}}
 	}
 	var offset int64
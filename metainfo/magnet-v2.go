@@ -17,9 +17,10 @@ import (
 type MagnetV2 struct {
 	InfoHash    g.Option[Hash] // Expected in this implementation
 	V2InfoHash  g.Option[infohash_v2.T]
-	Trackers    []string   // "tr" values
-	DisplayName string     // "dn" value, if not empty
-	Params      url.Values // All other values, such as "x.pe", "as", "xs" etc.
+	Trackers    []string         // "tr" values
+	DisplayName string           // "dn" value, if not empty
+	SelectOnly  []FileIndexRange // "so" value, the files to download if not all of them (BEP 53)
+	Params      url.Values       // All other values, such as "x.pe", "as", "xs" etc.
 }
 
 const (
@@ -59,6 +60,10 @@ func (m MagnetV2) String() string {
 	if rem := vs.Encode(); rem != "" {
 		queryParts = append(queryParts, rem)
 	}
+	if len(m.SelectOnly) != 0 {
+		// The commas don't need escaping, and it's more readable this way.
+		queryParts = append(queryParts, "so="+FormatSelectOnly(m.SelectOnly))
+	}
 	u.RawQuery = strings.Join(queryParts, "&")
 	return u.String()
 }
@@ -106,6 +111,16 @@ func ParseMagnetV2Uri(uri string) (m MagnetV2, err error) {
 	m.DisplayName = popFirstValue(q, "dn").UnwrapOrZeroValue()
 	m.Trackers = q["tr"]
 	q.Del("tr")
+	for _, so := range q["so"] {
+		var ranges []FileIndexRange
+		ranges, err = ParseSelectOnly(so)
+		if err != nil {
+			err = fmt.Errorf("error parsing select-only %q: %w", so, err)
+			return
+		}
+		m.SelectOnly = append(m.SelectOnly, ranges...)
+	}
+	q.Del("so")
 	// Add everything we haven't consumed.
 	copyParams(&m.Params, q)
 	return
@@ -36,3 +36,17 @@ func TestParseMagnetV2(t *testing.T) {
 	c.Check(m.InfoHash.HexString(), qt.Equals, "631a31dd0a46257d5078c0dee4e66e26f73e42ac")
 	c.Check(m.Params["xt"], qt.HasLen, 1)
 }
+
+func TestMagnetV2SelectOnly(t *testing.T) {
+	c := qt.New(t)
+	const uri = "magnet:?xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac&so=0,2,4,6-8"
+	m, err := ParseMagnetV2Uri(uri)
+	c.Assert(err, qt.IsNil)
+	c.Check(m.SelectOnly, qt.DeepEquals, []FileIndexRange{{0, 0}, {2, 2}, {4, 4}, {6, 8}})
+	c.Check(m.Params, qt.HasLen, 0)
+	c.Check(m.String(), qt.Equals, uri)
+	for _, bad := range []string{"", "a", "1-", "-1", "3-2", "1,,2"} {
+		_, err = ParseMagnetV2Uri("magnet:?so=" + bad)
+		c.Check(err, qt.IsNotNil, qt.Commentf("%q", bad))
+	}
+}
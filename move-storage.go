@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Moves the Torrent's data to newDir, which takes the place of the base directory the storage was
+// created with. Files are renamed where possible, and copied and verified otherwise. Reads and
+// writes wait for the move, and the Torrent continues to seed from the new location afterwards. On
+// error or cancellation the data is left at the old location. The storage must support moving, as
+// the file and mmap storages do. See StorageMoveProgress.
+func (t *Torrent) MoveStorage(ctx context.Context, newDir string) error {
+	t.cl.lock()
+	if t.storage == nil {
+		t.cl.unlock()
+		return errors.New("torrent storage not open")
+	}
+	move := t.storage.Move
+	if move == nil {
+		t.cl.unlock()
+		return errors.New("torrent storage does not support moving")
+	}
+	t.cl.unlock()
+	t.storageMoveMu.Lock()
+	if t.storageMove.Ok {
+		t.storageMoveMu.Unlock()
+		return errors.New("torrent storage move already in progress")
+	}
+	t.storageMove.Set(storage.MoveProgress{})
+	t.storageMoveMu.Unlock()
+	// Progress is reported with the storage locked, and the storage is used under the Client lock
+	// elsewhere, so progress mustn't take the Client lock.
+	err := move(ctx, newDir, func(p storage.MoveProgress) {
+		t.storageMoveMu.Lock()
+		t.storageMove.Set(p)
+		t.storageMoveMu.Unlock()
+	})
+	t.storageMoveMu.Lock()
+	t.storageMove.SetNone()
+	t.storageMoveMu.Unlock()
+	if err != nil {
+		t.logger.Levelf(log.Warning, "error moving storage to %q: %v", newDir, err)
+		return err
+	}
+	t.logger.Levelf(log.Info, "moved storage to %q", newDir)
+	return nil
+}
+
+// Returns the progress of a MoveStorage call, if one is running.
+func (t *Torrent) StorageMoveProgress() g.Option[storage.MoveProgress] {
+	t.storageMoveMu.Lock()
+	defer t.storageMoveMu.Unlock()
+	return t.storageMove
+}
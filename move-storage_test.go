@@ -0,0 +1,100 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestMoveStorage(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Assert(tt.Complete.Bool(), qt.IsTrue)
+
+	newDir := t.TempDir()
+	c.Assert(tt.MoveStorage(context.Background(), newDir), qt.IsNil)
+	c.Check(tt.StorageMoveProgress().Ok, qt.IsFalse)
+	_, err = os.Stat(filepath.Join(newDir, testutil.GreetingFileName))
+	c.Assert(err, qt.IsNil)
+	_, err = os.Stat(filepath.Join(dir, testutil.GreetingFileName))
+	c.Check(os.IsNotExist(err), qt.IsTrue)
+
+	r := tt.NewReader()
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, testutil.GreetingFileContents)
+}
+
+// Storage that's being moved is locked, and the Client lock is held when checking piece completion,
+// so moving mustn't wait on the Client lock.
+func TestMoveStorageWhileCheckingCompletion(t *testing.T) {
+	c := qt.New(t)
+	// Many files, so the move reports progress many times.
+	dir := t.TempDir()
+	for i := range 100 {
+		name := filepath.Join(dir, "files", fmt.Sprintf("%03d", i))
+		c.Assert(os.MkdirAll(filepath.Dir(name), 0o777), qt.IsNil)
+		c.Assert(os.WriteFile(name, []byte("hello"), 0o644), qt.IsNil)
+	}
+	info := metainfo.Info{PieceLength: 1 << 10}
+	c.Assert(info.BuildFromFilePath(filepath.Join(dir, "files")), qt.IsNil)
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(info)}
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+
+	moved := make(chan error)
+	go func() {
+		dirs := [2]string{t.TempDir(), dir}
+		for i := range 20 {
+			err := tt.MoveStorage(context.Background(), dirs[i%2])
+			if err != nil {
+				moved <- err
+				return
+			}
+		}
+		close(moved)
+	}()
+	for {
+		select {
+		case err := <-moved:
+			c.Assert(err, qt.IsNil)
+			tt.VerifyData()
+			c.Check(tt.Complete.Bool(), qt.IsTrue)
+			return
+		default:
+		}
+		tt.Piece(0).UpdateCompletion()
+	}
+}
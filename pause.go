@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Stops all network activity for the Torrent: tracker announcers send stopped, the DHT announcer
+// waits, webseeds stop requesting, no new connections are made or accepted, and existing
+// connections are closed. Dials already in progress are dropped when they complete. Piece state,
+// readers and storage remain available. See Resume.
+func (t *Torrent) Pause() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.paused = true
+	t.updateNetworkingEnabled("Torrent.Pause")
+	t.cl.queueChanged()
+}
+
+// Undoes Pause.
+func (t *Torrent) Resume() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.paused = false
+	t.updateNetworkingEnabled("Torrent.Resume")
+	t.cl.queueChanged()
+}
+
+// Returns whether Pause was called without a subsequent Resume.
+func (t *Torrent) Paused() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.paused
+}
+
+func (t *Torrent) wantNetworking() bool {
+	return !t.paused && !t.queued
+}
+
+// Enables or disables networking to match wantNetworking.
+func (t *Torrent) updateNetworkingEnabled(reason string) {
+	want := t.wantNetworking()
+	if want == t.networkingEnabled.Bool() {
+		return
+	}
+	t.logger.Levelf(log.Debug, "networking enabled: %v (%v)", want, reason)
+	if want {
+		t.networkingEnabled.Set()
+	} else {
+		t.networkingEnabled.Clear()
+		for c := range t.conns {
+			t.dropConnection(c)
+		}
+	}
+	// Webseeds stay around but don't request anything while networking is disabled.
+	t.iterPeers(func(p *Peer) {
+		p.updateRequests(reason)
+	})
+	t.announceWebsocketTrackers(func() tracker.AnnounceEvent {
+		if want {
+			return tracker.Started
+		}
+		return tracker.Stopped
+	}())
+	if want {
+		t.openNewConns()
+	}
+	t.updateWantPeersEvent()
+	// Wakes the DHT announcer and tracker scrapers.
+	t.cl.event.Broadcast()
+}
+
+func (t *Torrent) announceWebsocketTrackers(event tracker.AnnounceEvent) {
+	for key, announcer := range t.trackerAnnouncers {
+		wst, ok := announcer.(websocketTrackerStatus)
+		if !ok {
+			continue
+		}
+		go func() {
+			err := wst.tc.Announce(event, key.shortInfohash)
+			if err != nil {
+				t.logger.WithDefaultLevel(log.Warning).Printf(
+					"error announcing %v to %q: %v", event, wst.url.String(), err)
+			}
+		}()
+	}
+}
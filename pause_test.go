@@ -0,0 +1,84 @@
+package torrent
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestPauseResume(t *testing.T) {
+	c := qt.New(t)
+	seederDataDir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(seederDataDir)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = seederDataDir
+	seeder, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer seeder.Close()
+	seederTorrent, _, _ := seeder.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	seederTorrent.VerifyData()
+
+	cfg = TestingConfig(t)
+	cfg.DataDir = t.TempDir()
+	leecher, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer leecher.Close()
+	leecherTorrent, _, _ := leecher.AddTorrentSpec(TorrentSpecFromMetaInfo(mi))
+	leecherTorrent.Pause()
+	c.Check(leecherTorrent.Paused(), qt.IsTrue)
+	leecherTorrent.AddClientPeer(seeder)
+	stats := leecherTorrent.Stats()
+	c.Check(stats.Paused, qt.IsTrue)
+	c.Check(stats.HalfOpenPeers, qt.Equals, 0)
+	c.Check(stats.ActivePeers, qt.Equals, 0)
+
+	// Readers wait for the torrent to be resumed.
+	type readResult struct {
+		b   []byte
+		err error
+	}
+	readDone := make(chan readResult, 1)
+	go func() {
+		r := leecherTorrent.NewReader()
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		readDone <- readResult{b, err}
+	}()
+	select {
+	case res := <-readDone:
+		c.Fatalf("read returned while paused: %v", res.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	leecherTorrent.DownloadAll()
+	leecherTorrent.Resume()
+	c.Check(leecherTorrent.Stats().Paused, qt.IsFalse)
+	res := <-readDone
+	c.Assert(res.err, qt.IsNil)
+	c.Check(string(res.b), qt.Equals, testutil.GreetingFileContents)
+	<-leecherTorrent.Complete.On()
+	c.Check(leecherTorrent.BytesMissing(), qt.Equals, int64(0))
+
+	leecherTorrent.Pause()
+	c.Check(leecherTorrent.Stats().ActivePeers, qt.Equals, 0)
+	c.Check(leecherTorrent.BytesMissing(), qt.Equals, int64(0))
+
+	// Dials that are already in progress are rejected when they complete.
+	nc, other := net.Pipe()
+	defer nc.Close()
+	defer other.Close()
+	leecher.lock()
+	pc := leecher.newConnection(nc, newConnectionOpts{outgoing: true, network: "pipe"})
+	pc.PeerExtensionBytes = leecher.config.Extensions
+	err = leecherTorrent.runHandshookConn(pc)
+	leecher.unlock()
+	c.Check(err, qt.ErrorMatches, ".*torrent networking disabled")
+	c.Check(leecherTorrent.Stats().ActivePeers, qt.Equals, 0)
+}
@@ -93,6 +93,8 @@ type (
 		// Pieces we've accepted chunks for from the peer.
 		peerTouchedPieces map[pieceIndex]struct{}
 		peerAllowedFast   typedRoaring.Bitmap[pieceIndex]
+		// The pieces the peer most recently suggested, oldest first.
+		peerSuggestedPieces []pieceIndex
 
 		PeerMaxRequests maxRequests // Maximum pending requests the peer allows.
 
@@ -456,10 +458,16 @@ func (cn *Peer) request(r RequestIndex) (more bool, err error) {
 		cn.validReceiveChunks = make(map[RequestIndex]int)
 	}
 	cn.validReceiveChunks[r]++
-	cn.t.requestState[r] = requestState{
+	state := requestState{
 		peer: cn,
 		when: time.Now(),
 	}
+	if cn.t.requestingPeer(r) != nil {
+		// Another peer has the request too. This is allowed for pieces with late deadlines.
+		cn.t.addDuplicateRequest(r, state)
+	} else {
+		cn.t.requestState[r] = state
+	}
 	cn.updateExpectingChunks()
 	ppReq := cn.t.requestIndexToRequest(r)
 	for _, f := range cn.callbacks.SentRequest {
@@ -676,6 +684,7 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 		f(ReceivedUsefulDataEvent{c, msg})
 	}
 	c.lastUsefulChunkReceived = time.Now()
+	t.lastUsefulData = c.lastUsefulChunkReceived
 
 	// Need to record that it hasn't been written yet, before we attempt to do
 	// anything with it.
@@ -685,7 +694,7 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 	piece.unpendChunkIndex(chunkIndexFromChunkSpec(ppReq.ChunkSpec, t.chunkSize))
 
 	// Cancel pending requests for this chunk from *other* peers.
-	if p := t.requestingPeer(req); p != nil {
+	for p := t.requestingPeer(req); p != nil; p = t.requestingPeer(req) {
 		if p == c {
 			panic("should not be pending request from conn that just received it")
 		}
@@ -774,10 +783,12 @@ func (c *Peer) deleteRequest(r RequestIndex) bool {
 		f(PeerRequestEvent{c, c.t.requestIndexToRequest(r)})
 	}
 	c.updateExpectingChunks()
-	if c.t.requestingPeer(r) != c {
-		panic("only one peer should have a given request at a time")
+	if c.t.requestingPeer(r) == c {
+		delete(c.t.requestState, r)
+		c.t.promoteDuplicateRequest(r)
+	} else if !c.t.deleteDuplicateRequest(r, c) {
+		panic("only one peer should have a given request at a time, unless duplicated")
 	}
-	delete(c.t.requestState, r)
 	// c.t.iterPeers(func(p *Peer) {
 	// 	if p.isLowOnRequests() {
 	// 		p.updateRequests("Peer.deleteRequest")
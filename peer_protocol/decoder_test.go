@@ -91,3 +91,19 @@ func TestDecodeOverlongPiece(t *testing.T) {
 	var m Message
 	require.Error(t, d.Decode(&m))
 }
+
+func TestDecodeHashesRoundTrip(t *testing.T) {
+	c := qt.New(t)
+	for _, msg := range []Message{
+		{Type: Hashes, PiecesRoot: [32]byte{1}, BaseLayer: 2, Index: 4, Length: 2, ProofLayers: 3, Hashes: [][32]byte{{5}, {6}, {7}}},
+		{Type: HashReject, PiecesRoot: [32]byte{1}, BaseLayer: 2, Index: 4, Length: 2, ProofLayers: 3},
+	} {
+		d := Decoder{
+			R:         bufio.NewReader(bytes.NewReader(msg.MustMarshalBinary())),
+			MaxLength: 1 << 18,
+		}
+		var decoded Message
+		c.Assert(d.Decode(&decoded), qt.IsNil)
+		c.Check(decoded, qt.DeepEquals, msg)
+	}
+}
@@ -15,6 +15,8 @@ type (
 		Encryption bool `bencode:"e"`
 		// BEP 9
 		MetadataSize int `bencode:"metadata_size,omitempty"`
+		// BEP 21. The sender doesn't want any more data.
+		UploadOnly bool `bencode:"upload_only,omitempty"`
 		// The local client port. It would be redundant for the receiving side of
 		// a connection to send this.
 		Port   int       `bencode:"p,omitempty"`
@@ -30,6 +32,9 @@ type (
 const (
 	// http://www.bittorrent.org/beps/bep_0011.html
 	ExtensionNamePex ExtensionName = "ut_pex"
+	// http://www.bittorrent.org/beps/bep_0054.html. The payload is the big-endian 4-byte index of
+	// a piece the sender no longer has.
+	ExtensionNameDontHave ExtensionName = "lt_donthave"
 
 	ExtensionDeleteNumber ExtensionNumber = 0
 )
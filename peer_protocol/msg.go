@@ -117,9 +117,15 @@ func (msg Message) MarshalBinary() (data []byte, err error) {
 			_, err = buf.Write(msg.ExtendedPayload)
 		case Port:
 			err = binary.Write(&buf, binary.BigEndian, msg.Port)
-		case HashRequest:
+		case HashRequest, HashReject:
 			buf.Write(msg.PiecesRoot[:])
 			writeConsecutive(msg.BaseLayer, msg.Index, msg.Length, msg.ProofLayers)
+		case Hashes:
+			buf.Write(msg.PiecesRoot[:])
+			writeConsecutive(msg.BaseLayer, msg.Index, msg.Length, msg.ProofLayers)
+			for _, h := range msg.Hashes {
+				buf.Write(h[:])
+			}
 		default:
 			err = fmt.Errorf("unknown message type: %v", msg.Type)
 		}
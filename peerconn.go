@@ -31,6 +31,7 @@ import (
 	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	utHolepunch "github.com/anacrolix/torrent/peer_protocol/ut-holepunch"
+	typedRoaring "github.com/anacrolix/torrent/typed-roaring"
 )
 
 // Maintains the state of a BitTorrent-protocol based connection with a peer.
@@ -76,6 +77,10 @@ type PeerConn struct {
 	// The peer has everything. This can occur due to a special message, when
 	// we may not even know the number of pieces in the torrent yet.
 	peerSentHaveAll bool
+	// The peer doesn't want any more data (BEP 21), from its extended handshake.
+	peerUploadOnly bool
+	// The upload_only we last told the peer in an extended handshake, if we've sent one.
+	sentUploadOnly Option[bool]
 
 	peerRequestDataAllocLimiter alloclim.Limiter
 
@@ -88,6 +93,25 @@ type PeerConn struct {
 	// we can verify all the pieces for a file when they're all arrived before submitting them to
 	// the torrent.
 	receivedHashPieces map[[32]byte][][32]byte
+	// Limits the hash requests from the peer that we answer.
+	hashRequestLimiter *rate.Limiter
+
+	// The piece most recently revealed to the peer while super-seeding.
+	superSeedPiece Option[pieceIndex]
+	// The pieces we told the peer it can request while choked (BEP 6).
+	sentAllowedFast typedRoaring.Bitmap[pieceIndex]
+	// The pieces we've suggested to the peer.
+	sentSuggestions typedRoaring.Bitmap[pieceIndex]
+
+	// Whether the last choking round gave the peer an upload slot.
+	unchokedByChoker bool
+	lastUnchoked     time.Time
+	// Stats at the last periodic choking round, and the rates measured then.
+	chokerSampleTime   time.Time
+	chokerBytesRead    int64
+	chokerBytesWritten int64
+	chokerDownloadRate float64
+	chokerUploadRate   float64
 }
 
 func (cn *PeerConn) pexStatus() string {
@@ -170,6 +194,7 @@ func (cn *PeerConn) peerHasAllPieces() (all, known bool) {
 
 func (cn *PeerConn) onGotInfo(info *metainfo.Info) {
 	cn.setNumPieces(info.NumPieces())
+	cn.sendAllowedFast()
 }
 
 // Correct the PeerPieces slice length. Return false if the existing slice is invalid, such as by
@@ -272,6 +297,13 @@ func (cn *PeerConn) choke(msg messageWriter) (more bool) {
 	})
 	if !cn.fastEnabled() {
 		cn.deleteAllPeerRequests()
+		return
+	}
+	// Requests for allowed fast pieces are still served.
+	for r := range cn.peerRequests {
+		if !cn.servesAllowedFast(pieceIndex(r.Index)) {
+			cn.reject(r)
+		}
 	}
 	return
 }
@@ -406,6 +438,8 @@ func (cn *PeerConn) peerSentHave(piece pieceIndex) error {
 	if cn.t.wantPieceIndex(piece) {
 		cn.updateRequests("have")
 	}
+	// Before peerPiecesChanged, which might drop the peer.
+	cn.t.superSeedOnPeerHave(cn, piece)
 	cn.peerPiecesChanged()
 	return nil
 }
@@ -462,6 +496,7 @@ func (cn *PeerConn) peerSentBitfield(bf []bool) error {
 	if shouldUpdateRequests {
 		cn.updateRequests("bitfield")
 	}
+	cn.t.superSeedOnPeerBitfield(cn)
 	// We didn't guard this before, I see no reason to do it now.
 	cn.peerPiecesChanged()
 	return nil
@@ -493,7 +528,9 @@ func (cn *PeerConn) peerHasAllPiecesTriggers() {
 }
 
 func (cn *PeerConn) onPeerSentHaveAll() error {
-	cn.onPeerHasAllPieces()
+	cn.onPeerHasAllPiecesNoTriggers()
+	cn.t.superSeedOnPeerBitfield(cn)
+	cn.peerHasAllPiecesTriggers()
 	return nil
 }
 
@@ -562,11 +599,7 @@ func (c *PeerConn) reject(r Request) {
 }
 
 func (c *PeerConn) maximumPeerRequestChunkLength() (_ Option[int]) {
-	uploadRateLimiter := c.t.cl.config.UploadRateLimiter
-	if uploadRateLimiter.Limit() == rate.Inf {
-		return
-	}
-	return Some(uploadRateLimiter.Burst())
+	return minRateLimiterBurst(c.t.uploadRateLimiters())
 }
 
 // startFetch is for testing purposes currently.
@@ -579,7 +612,7 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 		}
 		return nil
 	}
-	if c.choking {
+	if c.choking && !c.servesAllowedFast(pieceIndex(r.Index)) {
 		torrent.Add("requests received while choking", 1)
 		if c.fastEnabled() {
 			torrent.Add("requests rejected while choking", 1)
@@ -606,6 +639,14 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 			return err
 		}
 	}
+	if c.t.superSeedingActive() && !c.sentHaves.Get(bitmap.BitIndex(r.Index)) {
+		// We haven't revealed this piece to the peer yet.
+		torrent.Add("requests received for pieces not revealed while super-seeding", 1)
+		if c.fastEnabled() {
+			c.reject(r)
+		}
+		return nil
+	}
 	if !c.t.havePiece(pieceIndex(r.Index)) {
 		// TODO: Tell the peer we don't have the piece, and reject this request.
 		requestsReceivedForMissingPieces.Add(1)
@@ -652,6 +693,7 @@ func (c *PeerConn) peerRequestDataReader(r Request, prs *peerRequestState) {
 		}
 		torrent.Add("peer request data read successes", 1)
 		prs.data = b
+		c.t.onPieceReadForPeer(pieceIndex(r.Index), c)
 		// This might be required for the error case too (#752 and #753).
 		c.tickleWriter()
 	}
@@ -817,9 +859,13 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			c.updateExpectingChunks()
 		case pp.Interested:
 			c.peerInterested = true
+			// The peer wants data after all.
+			c.peerUploadOnly = false
+			c.t.cl.chokeSoon()
 			c.tickleWriter()
 		case pp.NotInterested:
 			c.peerInterested = false
+			c.t.cl.chokeSoon()
 			// We don't clear their requests since it isn't clear in the spec.
 			// We'll probably choke them for this, which will clear them if
 			// appropriate, and is clearly specified.
@@ -863,7 +909,7 @@ func (c *PeerConn) mainReadLoop() (err error) {
 		case pp.Suggest:
 			torrent.Add("suggests received", 1)
 			log.Fmsg("peer suggested piece %d", msg.Index).AddValues(c, msg.Index).LogLevel(log.Debug, c.t.logger)
-			c.updateRequests("suggested")
+			c.onPeerSuggested(pieceIndex(msg.Index))
 		case pp.HaveAll:
 			err = c.onPeerSentHaveAll()
 		case pp.HaveNone:
@@ -882,8 +928,10 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			err = c.onReadExtendedMsg(msg.ExtendedID, msg.ExtendedPayload)
 		case pp.Hashes:
 			err = c.onReadHashes(&msg)
-		case pp.HashRequest, pp.HashReject:
-			c.logger.Levelf(log.Info, "received unimplemented BitTorrent v2 message: %v", msg.Type)
+		case pp.HashRequest:
+			err = c.onReadHashRequest(msg)
+		case pp.HashReject:
+			c.onReadHashReject(msg)
 		default:
 			err = fmt.Errorf("received unknown message type: %#v", msg.Type)
 		}
@@ -936,6 +984,7 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 		}
 		c.PeerListenPort = d.Port
 		c.PeerPrefersEncryption = d.Encryption
+		c.peerUploadOnly = d.UploadOnly
 		for name, id := range d.M {
 			if _, ok := c.PeerExtensionIDs[name]; !ok {
 				peersSupportingExtension.Add(
@@ -952,11 +1001,12 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 			}
 		}
 		c.requestPendingMetadata()
-		if !t.cl.config.DisablePEX {
+		if !t.cl.config.DisablePEX && !c.pex.Listed {
 			t.pex.Add(c) // we learnt enough now
 			// This checks the extension is supported internally.
 			c.pex.Init(c)
 		}
+		c.peerPiecesChanged()
 		return nil
 	}
 	extensionName, builtin, err := c.LocalLtepProtocolMap.LookupId(id)
@@ -992,6 +1042,8 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 		}
 		err = c.t.handleReceivedUtHolepunchMsg(msg, c)
 		return
+	case pp.ExtensionNameDontHave:
+		return c.onReadDontHave(payload)
 	default:
 		panic(fmt.Sprintf("unhandled builtin extension protocol %q", extensionName))
 	}
@@ -1011,7 +1063,8 @@ func (cn *PeerConn) rw() io.ReadWriter {
 	}{cn.r, cn.w}
 }
 
-func (c *PeerConn) uploadAllowed() bool {
+// Whether we're willing to upload to the peer at all. The choker decides whether we actually do.
+func (c *PeerConn) uploadEligible() bool {
 	if c.t.cl.config.NoUpload {
 		return false
 	}
@@ -1021,14 +1074,11 @@ func (c *PeerConn) uploadAllowed() bool {
 	if c.t.seeding() {
 		return true
 	}
-	if !c.peerHasWantedPieces() {
-		return false
-	}
-	// Don't upload more than 100 KiB more than we download.
-	if c._stats.BytesWrittenData.Int64() >= c._stats.BytesReadData.Int64()+100<<10 {
-		return false
-	}
-	return true
+	return c.peerHasWantedPieces()
+}
+
+func (c *PeerConn) uploadAllowed() bool {
+	return c.unchokedByChoker && c.uploadEligible()
 }
 
 func (c *PeerConn) setRetryUploadTimer(delay time.Duration) {
@@ -1041,25 +1091,39 @@ func (c *PeerConn) setRetryUploadTimer(delay time.Duration) {
 
 // Also handles choking and unchoking of the remote peer.
 func (c *PeerConn) upload(msg func(pp.Message) bool) bool {
-	// Breaking or completing this loop means we don't want to upload to the peer anymore, and we
-	// choke them.
+	// While we don't want to upload to the peer, we choke them and only serve requests for allowed
+	// fast pieces.
 another:
-	for c.uploadAllowed() {
-		// We want to upload to the peer.
-		if !c.unchoke(msg) {
+	for {
+		unchoked := c.uploadAllowed()
+		if unchoked {
+			// We want to upload to the peer.
+			if !c.unchoke(msg) {
+				return false
+			}
+		} else if !c.choke(msg) {
 			return false
 		}
 		for r, state := range c.peerRequests {
 			if state.data == nil {
 				continue
 			}
-			res := c.t.cl.config.UploadRateLimiter.ReserveN(time.Now(), int(r.Length))
-			if !res.OK() {
-				panic(fmt.Sprintf("upload rate limiter burst size < %d", r.Length))
+			if !unchoked && !c.servesAllowedFast(pieceIndex(r.Index)) {
+				continue
+			}
+			delay, ok := reserveRateLimiters(int(r.Length), c.t.uploadRateLimiters())
+			if !ok {
+				// The burst of a limiter was reduced after the request was accepted.
+				c.logger.Levelf(log.Warning, "upload rate limiter burst size < %d", r.Length)
+				if c.fastEnabled() {
+					c.reject(r)
+				} else {
+					state.allocReservation.Drop()
+					delete(c.peerRequests, r)
+				}
+				goto another
 			}
-			delay := res.Delay()
 			if delay > 0 {
-				res.Cancel()
 				c.setRetryUploadTimer(delay)
 				// Hard to say what to return here.
 				return true
@@ -1073,7 +1137,6 @@ another:
 		}
 		return true
 	}
-	return c.choke(msg)
 }
 
 func (cn *PeerConn) drop() {
@@ -1203,7 +1266,7 @@ func (c *PeerConn) useful() bool {
 }
 
 func makeBuiltinLtepProtocols(pex bool) LocalLtepProtocolMap {
-	ps := []pp.ExtensionName{pp.ExtensionNameMetadata, utHolepunch.ExtensionName}
+	ps := []pp.ExtensionName{pp.ExtensionNameMetadata, utHolepunch.ExtensionName, pp.ExtensionNameDontHave}
 	if pex {
 		ps = append(ps, pp.ExtensionNamePex)
 	}
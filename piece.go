@@ -225,6 +225,9 @@ func (p *Piece) purePriority() (ret piecePriority) {
 	if p.t.readerReadaheadPieces().Contains(bitmap.BitIndex(p.index)) {
 		ret.Raise(PiecePriorityReadahead)
 	}
+	if _, ok := p.t.pieceDeadlines[p.index]; ok {
+		ret.Raise(PiecePriorityHigh)
+	}
 	ret.Raise(p.priority)
 	return
 }
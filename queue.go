@@ -0,0 +1,216 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// How often the queue is reevaluated for stalled downloads and changes that don't trigger an
+// update directly.
+const queueUpdateInterval = 10 * time.Second
+
+// Returns whether the Torrent is waiting for an active download or seed slot. Queued torrents have
+// networking disabled like paused ones. See ClientConfig.ActiveDownloadsLimit.
+func (t *Torrent) Queued() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.queued
+}
+
+// Returns the Torrent's position in the Client's queue, starting at 0. Torrents earlier in the queue
+// get active slots first. Returns -1 if the Torrent has been dropped.
+func (t *Torrent) QueuePosition() int {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return slices.Index(t.cl.queue, t)
+}
+
+// Moves the Torrent to the given position in the Client's queue. The position is clamped to the
+// bounds of the queue.
+func (t *Torrent) SetQueuePosition(pos int) {
+	cl := t.cl
+	cl.lock()
+	defer cl.unlock()
+	cur := slices.Index(cl.queue, t)
+	if cur == -1 {
+		return
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	if pos >= len(cl.queue) {
+		pos = len(cl.queue) - 1
+	}
+	if pos == cur {
+		return
+	}
+	cl.queue = slices.Insert(slices.Delete(cl.queue, cur, cur+1), pos, t)
+	cl.queueChanged()
+}
+
+// Moves the Torrent one position towards the front of the queue.
+func (t *Torrent) QueueMoveUp() {
+	t.SetQueuePosition(t.QueuePosition() - 1)
+}
+
+// Moves the Torrent one position towards the back of the queue.
+func (t *Torrent) QueueMoveDown() {
+	if pos := t.QueuePosition(); pos != -1 {
+		t.SetQueuePosition(pos + 1)
+	}
+}
+
+func (t *Torrent) QueueMoveTop() {
+	t.SetQueuePosition(0)
+}
+
+func (t *Torrent) QueueMoveBottom() {
+	t.SetQueuePosition(math.MaxInt)
+}
+
+func (cl *Client) addToQueue(t *Torrent) {
+	t.queueActiveSince = time.Now()
+	cl.queue = append(cl.queue, t)
+	cl.queueChanged()
+}
+
+func (cl *Client) removeFromQueue(t *Torrent) {
+	if i := slices.Index(cl.queue, t); i != -1 {
+		cl.queue = slices.Delete(cl.queue, i, i+1)
+	}
+	cl.queueChanged()
+}
+
+// Schedules reevaluating the queue when the Client lock is released. This can be called from deep
+// within state changes where dropping connections would be unsafe.
+func (cl *Client) queueChanged() {
+	if cl.queueUpdatePending {
+		return
+	}
+	cl.queueUpdatePending = true
+	cl._mu.Defer(func() {
+		cl.queueUpdatePending = false
+		cl.updateQueue()
+	})
+}
+
+// Assigns active download and seed slots in queue order, and queues the remaining torrents.
+func (cl *Client) updateQueue() {
+	cl.requeueStalledDownloads(time.Now())
+	var downloads, seeds int
+	for _, t := range cl.queue {
+		if t.closed.IsSet() || t.paused {
+			// Paused torrents don't hold a slot, and are reconsidered when they're resumed.
+			t.setQueued(false)
+			continue
+		}
+		if t.needData() {
+			queued := cl.config.ActiveDownloadsLimit > 0 && downloads >= cl.config.ActiveDownloadsLimit
+			if !queued {
+				downloads++
+			}
+			t.setQueued(queued)
+		} else if t.seeding() {
+			queued := cl.config.ActiveSeedsLimit > 0 && seeds >= cl.config.ActiveSeedsLimit
+			if !queued {
+				seeds++
+			}
+			t.setQueued(queued)
+		} else {
+			t.setQueued(false)
+		}
+	}
+}
+
+// Moves stalled active downloads to the back of the queue if other downloads are waiting, so the
+// waiting downloads get their slots.
+func (cl *Client) requeueStalledDownloads(now time.Time) {
+	waitingDownload := func(t *Torrent) bool {
+		return t.queued && !t.paused && !t.closed.IsSet() && t.needData()
+	}
+	if !slices.ContainsFunc(cl.queue, waitingDownload) {
+		return
+	}
+	var stalled []*Torrent
+	cl.queue = slices.DeleteFunc(cl.queue, func(t *Torrent) bool {
+		if t.queued || t.paused || t.closed.IsSet() || !t.needData() || !t.downloadStalled(now) {
+			return false
+		}
+		stalled = append(stalled, t)
+		return true
+	})
+	cl.queue = append(cl.queue, stalled...)
+}
+
+func (t *Torrent) setQueued(queued bool) {
+	if queued == t.queued {
+		return
+	}
+	t.queued = queued
+	if !queued {
+		t.queueActiveSince = time.Now()
+	}
+	t.updateNetworkingEnabled("queue")
+}
+
+// Returns whether an active download hasn't received useful data within
+// ClientConfig.QueueStallTimeout.
+func (t *Torrent) downloadStalled(now time.Time) bool {
+	timeout := t.cl.config.QueueStallTimeout
+	if timeout <= 0 {
+		return false
+	}
+	last := t.queueActiveSince
+	if t.lastUsefulData.After(last) {
+		last = t.lastUsefulData
+	}
+	return now.Sub(last) >= timeout
+}
+
+func (cl *Client) queueUpdater() {
+	for {
+		select {
+		case <-cl.closed.Done():
+			return
+		case <-time.After(queueUpdateInterval):
+			cl.lock()
+			cl.queueChanged()
+			cl.unlock()
+		}
+	}
+}
+
+func (cl *Client) writeQueueStatus(w io.Writer) {
+	limitString := func(limit int) string {
+		if limit <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(limit)
+	}
+	fmt.Fprintf(w, "Queue (download slots: %s, seed slots: %s):\n",
+		limitString(cl.config.ActiveDownloadsLimit),
+		limitString(cl.config.ActiveSeedsLimit))
+	now := time.Now()
+	for i, t := range cl.queue {
+		state := func() string {
+			switch {
+			case t.paused:
+				return "paused"
+			case t.queued:
+				return "queued"
+			case t.needData() && t.downloadStalled(now):
+				return "stalled"
+			case t.needData():
+				return "downloading"
+			case t.seeding():
+				return "seeding"
+			default:
+				return "idle"
+			}
+		}()
+		fmt.Fprintf(w, "  %d: %s %s\n", i, state, t)
+	}
+}
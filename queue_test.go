@@ -0,0 +1,86 @@
+package torrent
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestQueueActiveDownloadsLimit(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.ActiveDownloadsLimit = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	a, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	b, _ := cl.AddTorrentInfoHash(metainfo.Hash{2})
+	c.Check(a.QueuePosition(), qt.Equals, 0)
+	c.Check(b.QueuePosition(), qt.Equals, 1)
+	c.Check(a.Queued(), qt.IsFalse)
+	c.Check(b.Queued(), qt.IsTrue)
+	c.Check(b.Stats().Queued, qt.IsTrue)
+
+	b.QueueMoveUp()
+	c.Check(b.QueuePosition(), qt.Equals, 0)
+	c.Check(a.Queued(), qt.IsTrue)
+	c.Check(b.Queued(), qt.IsFalse)
+
+	// Paused torrents don't hold a slot.
+	b.Pause()
+	c.Check(a.Queued(), qt.IsFalse)
+	c.Check(b.Queued(), qt.IsFalse)
+	b.Resume()
+	c.Check(a.Queued(), qt.IsTrue)
+
+	var buf bytes.Buffer
+	cl.WriteStatus(&buf)
+	c.Check(buf.String(), qt.Contains, "Queue (download slots: 1, seed slots: unlimited):")
+
+	// Dropping the active torrent promotes the next one.
+	b.Drop()
+	c.Check(a.QueuePosition(), qt.Equals, 0)
+	c.Check(a.Queued(), qt.IsFalse)
+}
+
+func TestQueueStalledDownloadsRequeued(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.ActiveDownloadsLimit = 1
+	cfg.QueueStallTimeout = time.Minute
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	a, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	b, _ := cl.AddTorrentInfoHash(metainfo.Hash{2})
+	stall := func(ts ...*Torrent) {
+		cl.lock()
+		for _, t := range ts {
+			t.queueActiveSince = time.Now().Add(-2 * cfg.QueueStallTimeout)
+		}
+		cl.queueChanged()
+		cl.unlock()
+	}
+	c.Check(a.Queued(), qt.IsFalse)
+	c.Check(b.Queued(), qt.IsTrue)
+
+	// The stalled download gives its slot to the waiting one, rather than both being active.
+	stall(a, b)
+	c.Check(a.Queued(), qt.IsTrue)
+	c.Check(b.Queued(), qt.IsFalse)
+	c.Check(a.QueuePosition(), qt.Equals, 1)
+
+	// The promoted download starts a new stall timeout.
+	stall(a)
+	c.Check(a.Queued(), qt.IsTrue)
+	c.Check(b.Queued(), qt.IsFalse)
+
+	stall(a, b)
+	c.Check(a.Queued(), qt.IsFalse)
+	c.Check(b.Queued(), qt.IsTrue)
+	c.Check(a.QueuePosition(), qt.Equals, 0)
+}
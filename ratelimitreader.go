@@ -2,6 +2,7 @@ package torrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -37,17 +38,63 @@ func (me *rateLimitedReader) Read(b []byte) (n int, err error) {
 		}
 	} else {
 		// Limit the read to within the burst.
-		if me.l.Limit() != rate.Inf && len(b) > me.l.Burst() {
-			b = b[:me.l.Burst()]
+		if me.l.Limit() != rate.Inf {
+			burst := me.l.Burst()
+			if burst <= 0 {
+				err = errBurstZero
+				return
+			}
+			if len(b) > burst {
+				b = b[:burst]
+			}
 		}
 		n, err = me.r.Read(b)
 		now := time.Now()
-		r := me.l.ReserveN(now, n)
-		if !r.OK() {
-			panic(n)
-		}
 		me.lastRead = now
-		time.Sleep(r.Delay())
+		if payErr := me.pay(now, n); payErr != nil && err == nil {
+			err = payErr
+		}
 	}
 	return
 }
+
+var errBurstZero = errors.New("rate limiter burst is zero")
+
+// Waits for n tokens. The limit and burst can be changed concurrently, so n is reserved in portions
+// no larger than the current burst.
+func (me *rateLimitedReader) pay(now time.Time, n int) error {
+	for n > 0 {
+		take := n
+		if me.l.Limit() != rate.Inf {
+			burst := me.l.Burst()
+			if burst <= 0 {
+				return errBurstZero
+			}
+			take = min(take, burst)
+		}
+		r := me.l.ReserveN(now, take)
+		if !r.OK() {
+			// The burst shrank since we looked.
+			continue
+		}
+		time.Sleep(r.DelayFrom(now))
+		now = time.Now()
+		n -= take
+	}
+	return nil
+}
+
+// Rate limits reads with a limiter that may change between reads. No limit is applied while the
+// limiter is nil.
+type dynamicRateLimitedReader struct {
+	l func() *rate.Limiter
+	r io.Reader
+}
+
+func (me dynamicRateLimitedReader) Read(b []byte) (n int, err error) {
+	l := me.l()
+	if l == nil {
+		return me.r.Read(b)
+	}
+	return (&rateLimitedReader{l: l, r: me.r}).Read(b)
+}
@@ -200,6 +200,7 @@ func (r *reader) waitAvailable(ctx context.Context, pos, wanted int64, wait bool
 		if !wait || wanted == 0 {
 			dontWait = closedChan
 		}
+		// Networking is disabled while the torrent is paused or queued. Wait for it to resume.
 		select {
 		case <-r.t.closed.Done():
 			err = errors.New("torrent closed")
@@ -209,9 +210,6 @@ func (r *reader) waitAvailable(ctx context.Context, pos, wanted int64, wait bool
 			return
 		case <-r.t.dataDownloadDisallowed.On():
 			err = errors.New("torrent data downloading disabled")
-		case <-r.t.networkingEnabled.Off():
-			err = errors.New("torrent networking disabled")
-			return
 		case <-dontWait:
 			return
 		case <-readerCond:
@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/log"
+)
+
+// Renames the file, changing where the storage keeps its data without changing the infohash.
+// newPath replaces the DisplayPath: '/' separated components relative to the torrent directory,
+// or the file name for a single-file torrent. See Torrent.RenameFiles.
+func (f *File) Rename(newPath string) error {
+	return f.t.RenameFiles(map[int]string{f.index(): newPath})
+}
+
+// The file's index in Torrent.Files.
+func (f *File) index() int {
+	return slices.Index(*f.t.files, f)
+}
+
+// Renames files, given by index in Files, to new display paths as for File.Rename. Existing data
+// is moved. The storage must support renaming, as the file storage does. The new paths are
+// included in ResumeData so they can be restored after a restart.
+func (t *Torrent) RenameFiles(renames map[int]string) error {
+	t.renameMu.Lock()
+	defer t.renameMu.Unlock()
+	t.cl.lock()
+	if !t.haveInfo() {
+		t.cl.unlock()
+		return errors.New("torrent info not available")
+	}
+	if t.storage == nil || t.storage.RenameFiles == nil {
+		t.cl.unlock()
+		return errors.New("torrent storage does not support renaming files")
+	}
+	components, err := t.fileRenameComponents(renames)
+	if err != nil {
+		t.cl.unlock()
+		return err
+	}
+	rename := t.storage.RenameFiles
+	t.cl.unlock()
+	// Renaming can be slow if the storage has to copy, so don't hold the Client lock.
+	err = rename(components)
+	if err != nil {
+		t.logger.Levelf(log.Warning, "error renaming files: %v", err)
+		return err
+	}
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.setFileDisplayPaths(renames)
+	return nil
+}
+
+// Checks renames and returns the new path components for the storage.
+func (t *Torrent) fileRenameComponents(renames map[int]string) (map[int][]string, error) {
+	files := *t.files
+	newPaths := make(map[string]int, len(files))
+	for i, f := range files {
+		newPaths[f.displayPath] = i
+	}
+	ret := make(map[int][]string, len(renames))
+	for i, newPath := range renames {
+		if i < 0 || i >= len(files) {
+			return nil, fmt.Errorf("file index %v out of range", i)
+		}
+		components := strings.Split(newPath, "/")
+		for _, c := range components {
+			if c == "" || c == "." || c == ".." {
+				return nil, fmt.Errorf("bad file path %q", newPath)
+			}
+		}
+		ret[i] = components
+		delete(newPaths, files[i].displayPath)
+	}
+	for i, newPath := range renames {
+		if j, ok := newPaths[newPath]; ok {
+			return nil, fmt.Errorf("file %v and file %v would have path %q", i, j, newPath)
+		}
+		newPaths[newPath] = i
+	}
+	return ret, nil
+}
+
+// Readers hold either the Client lock or nameMu, so both must be held.
+func (t *Torrent) setFileDisplayPaths(displayPaths map[int]string) {
+	t.nameMu.Lock()
+	defer t.nameMu.Unlock()
+	for i, displayPath := range displayPaths {
+		f := (*t.files)[i]
+		f.displayPath = displayPath
+		if t.info.IsDir() {
+			f.path = t.info.BestName() + "/" + displayPath
+		} else {
+			f.path = displayPath
+		}
+	}
+}
+
+// Returns the display paths of the files if any were renamed.
+func (t *Torrent) renamedFileDisplayPaths() (ret []string) {
+	renamed := false
+	for _, f := range *t.files {
+		ret = append(ret, f.displayPath)
+		renamed = renamed || f.displayPath != f.fi.DisplayPath(t.info)
+	}
+	if !renamed {
+		return nil
+	}
+	return
+}
+
+// Restores file renames from resume data. The storage is expected to find the data where it was
+// renamed to.
+func (t *Torrent) applyResumeDataFilePaths(displayPaths []string) {
+	if len(displayPaths) != len(*t.files) {
+		return
+	}
+	renames := make(map[int]string)
+	for i, f := range *t.files {
+		if displayPaths[i] != f.displayPath {
+			renames[i] = displayPaths[i]
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+	if t.storage == nil || t.storage.RenameFiles == nil {
+		t.logger.Levelf(log.Warning, "ignoring resume data file paths: storage does not support renaming files")
+		return
+	}
+	components, err := t.fileRenameComponents(renames)
+	if err == nil {
+		err = t.storage.RenameFiles(components)
+	}
+	if err != nil {
+		t.logger.Levelf(log.Warning, "ignoring resume data file paths: %v", err)
+		return
+	}
+	t.setFileDisplayPaths(renames)
+}
@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestFileRename(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	newClient := func() *Client {
+		cfg := TestingConfig(t)
+		cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: storage.NewMapPieceCompletion(),
+		})
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		return cl
+	}
+	readAll := func(tt *Torrent) string {
+		r := tt.NewReader()
+		defer r.Close()
+		b, err := io.ReadAll(r)
+		c.Assert(err, qt.IsNil)
+		return string(b)
+	}
+
+	cl := newClient()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Assert(tt.Complete.Bool(), qt.IsTrue)
+	ih := tt.InfoHash()
+	f := tt.Files()[0]
+	c.Check(f.Rename("../escape"), qt.IsNotNil)
+	c.Assert(f.Rename("clean/hello.txt"), qt.IsNil)
+	c.Check(f.DisplayPath(), qt.Equals, "clean/hello.txt")
+	c.Check(f.Path(), qt.Equals, "clean/hello.txt")
+	c.Check(tt.InfoHash(), qt.Equals, ih)
+	_, err = os.Stat(filepath.Join(dir, "clean", "hello.txt"))
+	c.Assert(err, qt.IsNil)
+	_, err = os.Stat(filepath.Join(dir, testutil.GreetingFileName))
+	c.Check(os.IsNotExist(err), qt.IsTrue)
+	c.Check(readAll(tt), qt.Equals, testutil.GreetingFileContents)
+	rd := tt.ResumeData()
+	c.Check(rd.FilePaths, qt.DeepEquals, []string{"clean/hello.txt"})
+	cl.Close()
+
+	cl = newClient()
+	defer cl.Close()
+	tt, _ = cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash:   ih,
+		ResumeData: &rd,
+	})
+	c.Assert(tt.Info(), qt.IsNotNil)
+	c.Check(tt.Files()[0].DisplayPath(), qt.Equals, "clean/hello.txt")
+	c.Check(tt.BytesMissing(), qt.Equals, int64(0))
+	c.Check(readAll(tt), qt.Equals, testutil.GreetingFileContents)
+}
+
+// Storage that accepts any renames, leaving the Torrent to check them.
+type renameAnythingStorage struct {
+	storage.ClientImpl
+}
+
+func (me renameAnythingStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t, err := me.ClientImpl.OpenTorrent(info, infoHash)
+	t.RenameFiles = func(map[int][]string) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	return t, err
+}
+
+func TestConcurrentFileRenames(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = renameAnythingStorage{storage.NewFile(t.TempDir())}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	info := metainfo.Info{
+		Name:        "t",
+		PieceLength: 1 << 10,
+		Files:       []metainfo.FileInfo{{Path: []string{"a"}, Length: 5}, {Path: []string{"b"}, Length: 5}},
+		Pieces:      make([]byte, 20),
+	}
+	tt, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(info)})
+	c.Assert(err, qt.IsNil)
+	files := tt.Files()
+	for range 20 {
+		// Both renames would give their file the same path, so only one can succeed.
+		var wg sync.WaitGroup
+		errs := make([]error, len(files))
+		for i, f := range files {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = f.Rename("x")
+			}()
+		}
+		wg.Wait()
+		c.Assert((errs[0] == nil) != (errs[1] == nil), qt.IsTrue, qt.Commentf("%v", errs))
+		for i, f := range files {
+			if errs[i] == nil {
+				c.Assert(f.Rename(info.Files[i].Path[0]), qt.IsNil)
+			}
+		}
+	}
+	c.Check(files[0].DisplayPath(), qt.Equals, "a")
+	c.Check(files[1].DisplayPath(), qt.Equals, "b")
+}
@@ -24,12 +24,24 @@ func pieceOrderLess(i, j *pieceRequestOrderItem) multiless.Computation {
 		int(j.state.Priority), int(i.state.Priority),
 		// TODO: Should we match on complete here to prevent churn when availability changes?
 	).Bool(
-		j.state.Partial, i.state.Partial,
-	).Int(
-		// If this is done with relative availability, do we lose some determinism? If completeness
-		// is used, would that push this far enough down?
-		i.state.Availability, j.state.Availability,
-	).Int(
+		i.state.Deadline.IsZero(), j.state.Deadline.IsZero(),
+	).CmpInt64(
+		i.state.Deadline.Sub(j.state.Deadline).Nanoseconds(),
+	).Bool(
+		j.state.Sequential, i.state.Sequential,
+	).Lazy(func() multiless.Computation {
+		// Both are sequential or neither is now. Sequential pieces go strictly by index.
+		if i.state.Sequential {
+			return multiless.New()
+		}
+		return multiless.New().Bool(
+			j.state.Partial, i.state.Partial,
+		).Int(
+			// If this is done with relative availability, do we lose some determinism? If
+			// completeness is used, would that push this far enough down?
+			i.state.Availability, j.state.Availability,
+		)
+	}).Int(
 		i.key.Index, j.key.Index,
 	).Lazy(func() multiless.Computation {
 		return multiless.New().Cmp(bytes.Compare(
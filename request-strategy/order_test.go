@@ -0,0 +1,53 @@
+package requestStrategy
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPieceOrderSequential(t *testing.T) {
+	c := qt.New(t)
+	pro := NewPieceOrder(NewAjwernerBtree(), 4)
+	add := func(index, availability int, sequential bool) {
+		pro.Add(PieceRequestOrderKey{Index: index}, PieceRequestOrderState{
+			Availability: availability,
+			Sequential:   sequential,
+		})
+	}
+	add(0, 3, true)
+	add(1, 1, true)
+	add(2, 0, false)
+	add(3, 2, false)
+	add(4, 2, true)
+	var order []int
+	pro.tree.Scan(func(item pieceRequestOrderItem) bool {
+		order = append(order, item.key.Index)
+		return true
+	})
+	// Sequential pieces ignore availability, and come before other pieces of the same priority.
+	c.Check(order, qt.DeepEquals, []int{0, 1, 4, 2, 3})
+}
+
+func TestPieceOrderDeadlines(t *testing.T) {
+	c := qt.New(t)
+	pro := NewPieceOrder(NewAjwernerBtree(), 4)
+	now := time.Now()
+	add := func(index int, deadline time.Time, sequential bool) {
+		pro.Add(PieceRequestOrderKey{Index: index}, PieceRequestOrderState{
+			Deadline:   deadline,
+			Sequential: sequential,
+		})
+	}
+	add(0, time.Time{}, true)
+	add(1, now.Add(time.Minute), false)
+	add(2, time.Time{}, false)
+	add(3, now.Add(time.Second), false)
+	var order []int
+	pro.tree.Scan(func(item pieceRequestOrderItem) bool {
+		order = append(order, item.key.Index)
+		return true
+	})
+	c.Check(order, qt.DeepEquals, []int{3, 1, 0, 2})
+}
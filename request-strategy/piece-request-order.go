@@ -1,6 +1,8 @@
 package requestStrategy
 
 import (
+	"time"
+
 	g "github.com/anacrolix/generics"
 
 	"github.com/anacrolix/torrent/metainfo"
@@ -33,6 +35,11 @@ type PieceRequestOrderState struct {
 	Availability int
 	Priority     piecePriority
 	Partial      bool
+	// Sequential pieces are ordered by index, ahead of other pieces of the same priority.
+	Sequential bool
+	// Pieces with deadlines are ordered by deadline, ahead of other pieces of the same priority.
+	// Zero if there's no deadline.
+	Deadline time.Time
 }
 
 type pieceRequestOrderItem struct {
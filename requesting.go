@@ -29,6 +29,8 @@ func (t *Torrent) requestStrategyPieceOrderState(i int) requestStrategy.PieceReq
 		Priority:     t.piece(i).purePriority(),
 		Partial:      t.piecePartiallyDownloaded(i),
 		Availability: t.piece(i).availability(),
+		Sequential:   t.pieceSequential(i),
+		Deadline:     t.pieceDeadline(i),
 	}
 }
 
@@ -116,6 +118,9 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 		}
 		return leftPriority
 	}()
+	// Pieces with deadlines come first, earliest deadline first.
+	ml = ml.Bool(leftPiece.Deadline.IsZero(), rightPiece.Deadline.IsZero())
+	ml = ml.CmpInt64(leftPiece.Deadline.Sub(rightPiece.Deadline).Nanoseconds())
 	if ml.Ok() {
 		return ml.MustLess()
 	}
@@ -147,6 +152,15 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 		// it will be served and therefore is the best candidate to cancel.
 		ml = ml.CmpInt64(rightLast.Sub(leftLast).Nanoseconds())
 	}
+	// Sequential pieces go strictly in index order.
+	ml = ml.Bool(rightPiece.Sequential, leftPiece.Sequential)
+	if leftPiece.Sequential && rightPiece.Sequential {
+		ml = ml.Int(leftPieceIndex, rightPieceIndex)
+	}
+	// Prefer pieces the peer suggested, they're probably cheap for it to serve.
+	if len(p.peer.peerSuggestedPieces) != 0 {
+		ml = ml.Bool(!p.peer.peerSuggested(leftPieceIndex), !p.peer.peerSuggested(rightPieceIndex))
+	}
 	ml = ml.Int(
 		leftPiece.Availability,
 		rightPiece.Availability)
@@ -177,6 +191,9 @@ func (p *Peer) getDesiredRequestState() (desired desiredRequestState) {
 	if t.dataDownloadDisallowed.Bool() {
 		return
 	}
+	if !t.networkingEnabled.Bool() {
+		return
+	}
 	input := t.getRequestStrategyInput()
 	requestHeap := desiredPeerRequests{
 		peer:           p,
@@ -195,6 +212,9 @@ func (p *Peer) getDesiredRequestState() (desired desiredRequestState) {
 			if !p.peerHasPiece(pieceIndex) {
 				return
 			}
+			if t.pieceDeadlineCritical(pieceIndex) && !t.fastPeerForPiece(p, pieceIndex) {
+				return
+			}
 			requestHeap.pieceStates[pieceIndex] = pieceExtra
 			allowedFast := p.peerAllowedFast.Contains(pieceIndex)
 			t.iterUndirtiedRequestIndexesInPiece(&it, pieceIndex, func(r requestStrategy.RequestIndex) {
@@ -309,7 +329,7 @@ func (p *Peer) applyRequestState(next desiredRequestState) {
 			panic("changed")
 		}
 		existing := t.requestingPeer(req)
-		if existing != nil && existing != p {
+		if existing != nil && existing != p && !current.Requests.Contains(req) && !t.allowDuplicateRequest(req) {
 			// Don't steal from the poor.
 			diff := int64(current.Requests.GetCardinality()) + 1 - (int64(existing.uncancelledRequests()) - 1)
 			// Steal a request that leaves us with one more request than the existing peer
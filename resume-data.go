@@ -0,0 +1,232 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// The version of ResumeData produced by this package. Resume data with a different version is
+// rejected.
+const ResumeDataVersion = 1
+
+// State of a Torrent that can be saved and given back to AddTorrentOpts.ResumeData after a restart,
+// so the Torrent continues where it left off without rehashing its data. It's bencoded by
+// MarshalBinary.
+type ResumeData struct {
+	Version  int    `bencode:"version"`
+	InfoHash []byte `bencode:"info hash"`
+	// The info dictionary, if it was available. This allows resuming a torrent added by magnet link
+	// without fetching the metadata again.
+	InfoBytes []byte `bencode:"info,omitempty"`
+	ChunkSize int    `bencode:"chunk size,omitempty"`
+	NumPieces int    `bencode:"num pieces,omitempty"`
+	// A serialized roaring bitmap of completed piece indexes.
+	CompletedPieces []byte                 `bencode:"completed pieces,omitempty"`
+	DirtyChunks     []ResumeDataDirtyPiece `bencode:"dirty chunks,omitempty"`
+	// File priorities in the order of Torrent.Files.
+	FilePriorities []int `bencode:"file priorities,omitempty"`
+	// File display paths in the order of Torrent.Files, if any were renamed.
+	FilePaths []string         `bencode:"file paths,omitempty"`
+	Trackers  [][]string       `bencode:"trackers,omitempty"`
+	WebSeeds  []string         `bencode:"webseeds,omitempty"`
+	Peers     []ResumeDataPeer `bencode:"peers,omitempty"`
+	// Totals from ConnStats.BytesWrittenData and ConnStats.BytesReadUsefulData.
+	Uploaded   int64 `bencode:"uploaded"`
+	Downloaded int64 `bencode:"downloaded"`
+}
+
+// The chunks written to an incomplete piece.
+type ResumeDataDirtyPiece struct {
+	Piece  int   `bencode:"piece"`
+	Chunks []int `bencode:"chunks"`
+}
+
+type ResumeDataPeer struct {
+	Addr   string     `bencode:"addr"`
+	Source PeerSource `bencode:"source,omitempty"`
+	// Whether the peer is known to support encryption.
+	SupportsEncryption bool `bencode:"encryption,omitempty"`
+	Trusted            bool `bencode:"trusted,omitempty"`
+}
+
+func (me ResumeData) MarshalBinary() ([]byte, error) {
+	return bencode.Marshal(me)
+}
+
+func (me *ResumeData) UnmarshalBinary(b []byte) error {
+	var rd ResumeData
+	err := bencode.Unmarshal(b, &rd)
+	if err != nil {
+		return err
+	}
+	if rd.Version != ResumeDataVersion {
+		return fmt.Errorf("unsupported resume data version %v", rd.Version)
+	}
+	*me = rd
+	return nil
+}
+
+// Returns the state needed to resume the Torrent later with AddTorrentOpts.ResumeData.
+func (t *Torrent) ResumeData() (rd ResumeData) {
+	// KnownSwarm takes the Client lock itself.
+	for _, p := range t.KnownSwarm() {
+		rd.Peers = append(rd.Peers, ResumeDataPeer{
+			Addr:               p.Addr.String(),
+			Source:             p.Source,
+			SupportsEncryption: p.SupportsEncryption,
+			Trusted:            p.Trusted,
+		})
+	}
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	rd.Version = ResumeDataVersion
+	rd.InfoHash = append([]byte(nil), t.canonicalShortInfohash().Bytes()...)
+	rd.ChunkSize = int(t.chunkSize)
+	for _, tier := range t.metainfo.UpvertedAnnounceList() {
+		rd.Trackers = append(rd.Trackers, append([]string(nil), tier...))
+	}
+	for url := range t.webSeeds {
+		rd.WebSeeds = append(rd.WebSeeds, url)
+	}
+	rd.Uploaded = t.stats.BytesWrittenData.Int64()
+	rd.Downloaded = t.stats.BytesReadUsefulData.Int64()
+	if !t.haveInfo() {
+		return
+	}
+	rd.InfoBytes = t.metadataBytes
+	rd.NumPieces = t.numPieces()
+	rd.CompletedPieces, _ = t._completedPieces.ToBytes()
+	for i := range t.pieces {
+		p := &t.pieces[i]
+		if t.pieceComplete(i) || !p.hasDirtyChunks() {
+			continue
+		}
+		dp := ResumeDataDirtyPiece{Piece: i}
+		for c := chunkIndexType(0); c < p.numChunks(); c++ {
+			if p.chunkIndexDirty(c) {
+				dp.Chunks = append(dp.Chunks, int(c))
+			}
+		}
+		rd.DirtyChunks = append(rd.DirtyChunks, dp)
+	}
+	for _, f := range *t.files {
+		rd.FilePriorities = append(rd.FilePriorities, int(f.prio))
+	}
+	rd.FilePaths = t.renamedFileDisplayPaths()
+	return
+}
+
+// Checks that resume data belongs to the Torrent.
+func (t *Torrent) resumeDataMatches(rd *ResumeData) error {
+	if rd.Version != ResumeDataVersion {
+		return fmt.Errorf("unsupported version %v", rd.Version)
+	}
+	var ih metainfo.Hash
+	if len(rd.InfoHash) != len(ih) {
+		return fmt.Errorf("bad infohash length %v", len(rd.InfoHash))
+	}
+	copy(ih[:], rd.InfoHash)
+	if ih != *t.canonicalShortInfohash() {
+		return fmt.Errorf("infohash %v does not match torrent", ih)
+	}
+	return nil
+}
+
+// Applies the parts of resume data that don't depend on the info. The rest is applied when the info
+// is set.
+func (t *Torrent) addResumeData(rd *ResumeData) {
+	if err := t.resumeDataMatches(rd); err != nil {
+		t.logger.Levelf(log.Warning, "ignoring resume data: %v", err)
+		return
+	}
+	t.stats.BytesWrittenData.Add(rd.Uploaded)
+	t.stats.BytesReadUsefulData.Add(rd.Downloaded)
+	t.addTrackers(rd.Trackers)
+	for _, url := range rd.WebSeeds {
+		t.addWebSeed(url)
+	}
+	peers := make([]PeerInfo, 0, len(rd.Peers))
+	for _, p := range rd.Peers {
+		peers = append(peers, PeerInfo{
+			Addr:               StringAddr(p.Addr),
+			Source:             p.Source,
+			SupportsEncryption: p.SupportsEncryption,
+			Trusted:            p.Trusted,
+		})
+	}
+	t.addPeers(peers)
+	t.resumeData = rd
+}
+
+// Applies the piece state and file priorities from resume data once the info is available. Completed
+// pieces are trusted without an initial check, and marked complete in storage later by
+// markResumedPiecesComplete.
+func (t *Torrent) applyResumeDataPieces() {
+	rd := t.resumeData
+	if rd == nil {
+		return
+	}
+	t.resumeData = nil
+	if rd.NumPieces != t.numPieces() {
+		t.logger.Levelf(log.Warning, "ignoring resume data with %v pieces", rd.NumPieces)
+		return
+	}
+	t.applyResumeDataFilePaths(rd.FilePaths)
+	if len(rd.FilePriorities) == len(*t.files) {
+		for i, prio := range rd.FilePriorities {
+			(*t.files)[i].prio = piecePriority(prio)
+		}
+	}
+	var completed roaring.Bitmap
+	if len(rd.CompletedPieces) != 0 {
+		if err := completed.UnmarshalBinary(rd.CompletedPieces); err != nil {
+			t.logger.Levelf(log.Warning, "ignoring resume data completed pieces: %v", err)
+			return
+		}
+	}
+	if pp.Integer(rd.ChunkSize) == t.chunkSize {
+		for _, dp := range rd.DirtyChunks {
+			if dp.Piece < 0 || dp.Piece >= t.numPieces() || completed.Contains(uint32(dp.Piece)) {
+				continue
+			}
+			p := t.piece(dp.Piece)
+			for _, c := range dp.Chunks {
+				if c >= 0 && chunkIndexType(c) < p.numChunks() {
+					t.dirtyChunks.Add(p.requestIndexOffset() + chunkIndexType(c))
+				}
+			}
+		}
+	}
+	completed.RemoveRange(uint64(t.numPieces()), roaring.MaxUint32+1)
+	t.resumedPieces = completed
+}
+
+// Marks the pieces completed by resume data complete in storage. Storage can be slow, for example
+// moving files to a completed dir, so it's done without the Client lock.
+func (t *Torrent) markResumedPiecesComplete() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	for !t.closed.IsSet() && !t.resumedPieces.IsEmpty() {
+		i := pieceIndex(t.resumedPieces.Minimum())
+		p := t.piece(i)
+		t.cl.unlock()
+		var err error
+		if !p.Storage().Completion().Complete {
+			err = p.Storage().MarkComplete()
+		}
+		t.cl.lock()
+		if err != nil {
+			t.logger.Levelf(log.Warning, "marking resumed piece %v complete: %v", i, err)
+		}
+		if !t.resumedPieces.CheckedRemove(uint32(i)) && !t.pieceComplete(i) {
+			// The piece was checked and failed while we were marking it.
+			p.Storage().MarkNotComplete()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestResumeDataSkipsInitialPieceCheck(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	newClient := func() *Client {
+		cfg := TestingConfig(t)
+		cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: storage.NewMapPieceCompletion(),
+		})
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		return cl
+	}
+
+	cl := newClient()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Assert(tt.BytesMissing(), qt.Equals, int64(0))
+	tt.Files()[0].SetPriority(PiecePriorityHigh)
+	tt.AddTrackers([][]string{{"http://example.com/announce"}})
+	b, err := tt.ResumeData().MarshalBinary()
+	c.Assert(err, qt.IsNil)
+	cl.Close()
+
+	var rd ResumeData
+	c.Assert(rd.UnmarshalBinary(b), qt.IsNil)
+	cl = newClient()
+	defer cl.Close()
+	tt, _ = cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash:   mi.HashInfoBytes(),
+		ResumeData: &rd,
+	})
+	c.Assert(tt.Info(), qt.IsNotNil)
+	cl.lock()
+	c.Check(tt.piecesQueuedForHash.IsEmpty(), qt.IsTrue)
+	c.Check(tt.activePieceHashes, qt.Equals, 0)
+	cl.unlock()
+	c.Check(tt.BytesMissing(), qt.Equals, int64(0))
+	// Storage is marked complete in the background. Finish it here to check the result.
+	tt.markResumedPiecesComplete()
+	for i := range tt.NumPieces() {
+		c.Check(tt.Piece(i).Storage().Completion().Complete, qt.IsTrue)
+	}
+	c.Check(tt.Files()[0].Priority(), qt.Equals, PiecePriorityHigh)
+	resumedMi := tt.Metainfo()
+	c.Check(resumedMi.UpvertedAnnounceList(), qt.DeepEquals, metainfo.AnnounceList{{"http://example.com/announce"}})
+}
+
+func TestResumeDataRejectsUnknownVersion(t *testing.T) {
+	b, err := ResumeData{Version: ResumeDataVersion + 1}.MarshalBinary()
+	qt.Assert(t, err, qt.IsNil)
+	var rd ResumeData
+	qt.Check(t, rd.UnmarshalBinary(b), qt.IsNotNil)
+}
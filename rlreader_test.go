@@ -4,6 +4,7 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -126,3 +127,30 @@ func TestRateLimitReaders(t *testing.T) {
 	}
 	assert.EqualValues(t, writeRounds*bytesPerRound, totalBytesRead)
 }
+
+// Changes the burst of the limiter during the read, after the rateLimitedReader has checked it.
+type shrinkBurstReader struct {
+	l     *rate.Limiter
+	burst int
+	r     io.Reader
+}
+
+func (me shrinkBurstReader) Read(b []byte) (int, error) {
+	me.l.SetBurst(me.burst)
+	return me.r.Read(b)
+}
+
+func TestRateLimitReaderBurstChanged(t *testing.T) {
+	l := rate.NewLimiter(1e6, 10)
+	r := rateLimitedReader{
+		l: l,
+		r: shrinkBurstReader{l, 3, strings.NewReader("hello, world")},
+	}
+	b := make([]byte, 12)
+	n, err := r.Read(b)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, wor", string(b[:n]))
+	l.SetBurst(0)
+	_, err = r.Read(b)
+	assert.ErrorIs(t, err, errBurstZero)
+}
@@ -0,0 +1,333 @@
+// Package scheduler applies a weekly schedule of bandwidth limits to a Client's rate limiters at
+// runtime, with an optional alternative speed mode.
+package scheduler
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"golang.org/x/time/rate"
+)
+
+// A rate and burst for a rate.Limiter. A zero Burst keeps the burst the limiter had when the
+// Scheduler was created. If that was zero too, finite rates get a default burst, since nothing could
+// get through them otherwise.
+type Limit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// Limits for each of the limiters. Limits that aren't set leave the limiter to lower precedence
+// rules, or its original value.
+type Limits struct {
+	Upload   g.Option[Limit]
+	Download g.Option[Limit]
+	Dial     g.Option[Limit]
+}
+
+// A window of time on some days of the week in which the rule applies.
+type Rule struct {
+	// Shown in status output.
+	Name string
+	// The days the window starts on. All days if empty.
+	Days []time.Weekday
+	// Wall clock times as offsets from midnight. If End is before Start, the window runs past midnight into the next
+	// day. If they're equal, the rule applies for the whole day.
+	Start time.Duration
+	End   time.Duration
+	// Applied while the rule is active.
+	Limits Limits
+	// Turns alternative speed mode on while the rule is active.
+	AltSpeed bool
+}
+
+type Schedule struct {
+	// Where rules overlap, later rules take precedence.
+	Rules []Rule
+	// Applied over the scheduled limits while alternative speed mode is on.
+	AltSpeedLimits Limits
+	// The time zone rules are evaluated in. Defaults to time.Local.
+	Location *time.Location
+}
+
+// The limiters a Scheduler controls. Nil limiters are ignored. The limiters must not be shared
+// with anything that isn't meant to be scheduled.
+type Limiters struct {
+	Upload   *rate.Limiter
+	Download *rate.Limiter
+	Dial     *rate.Limiter
+}
+
+type Scheduler struct {
+	mu       sync.Mutex
+	limiters Limiters
+	// The limits the limiters had before the Scheduler took them over.
+	original Limits
+	schedule Schedule
+	// Set by SetAltSpeed, until the active rules next change.
+	altSpeedOverride g.Option[bool]
+	active           []string
+	altSpeed         bool
+	nextChange       time.Time
+
+	changed chan struct{}
+	closed  chan struct{}
+	done    chan struct{}
+}
+
+// Creates a Scheduler, applies the limits for the current time, and keeps them updated until
+// Close.
+func New(limiters Limiters, schedule Schedule) *Scheduler {
+	s := &Scheduler{
+		limiters: limiters,
+		original: Limits{
+			Upload:   currentLimit(limiters.Upload),
+			Download: currentLimit(limiters.Download),
+			Dial:     currentLimit(limiters.Dial),
+		},
+		schedule: schedule,
+		changed:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.apply(time.Now())
+	s.mu.Unlock()
+	go s.run()
+	return s
+}
+
+func currentLimit(l *rate.Limiter) (ret g.Option[Limit]) {
+	if l == nil {
+		return
+	}
+	return g.Some(Limit{Rate: l.Limit(), Burst: l.Burst()})
+}
+
+// Stops updating the limiters and restores their original limits.
+func (s *Scheduler) Close() {
+	close(s.closed)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setLimits(s.original)
+}
+
+// Replaces the schedule, and applies it immediately.
+func (s *Scheduler) SetSchedule(schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = schedule
+	s.apply(time.Now())
+	s.wake()
+}
+
+// Turns alternative speed mode on or off. This overrides the schedule until the active rules next
+// change.
+func (s *Scheduler) SetAltSpeed(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.altSpeedOverride.Set(on)
+	s.apply(time.Now())
+}
+
+// Returns whether alternative speed mode is on.
+func (s *Scheduler) AltSpeed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.altSpeed
+}
+
+// Writes the active rules and alternative speed mode. This can be passed to
+// torrent.Client.AddStatusWriter.
+func (s *Scheduler) WriteStatus(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := "none"
+	if len(s.active) != 0 {
+		active = strings.Join(s.active, ", ")
+	}
+	fmt.Fprintf(w, "Bandwidth schedule: active rules: %s, alt speed: %v", active, s.altSpeed)
+	if s.altSpeedOverride.Ok {
+		fmt.Fprint(w, " (manual)")
+	}
+	fmt.Fprintf(w, ", next change: %v\n", s.nextChange.Format(time.RFC1123))
+}
+
+func (s *Scheduler) wake() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		wait := time.Until(s.nextChange)
+		s.mu.Unlock()
+		// Wake periodically anyway in case the wall clock jumps.
+		wait = min(wait, time.Hour)
+		t := time.NewTimer(wait)
+		select {
+		case <-s.closed:
+			t.Stop()
+			return
+		case <-s.changed:
+			t.Stop()
+		case <-t.C:
+			s.mu.Lock()
+			s.apply(time.Now())
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Scheduler) location() *time.Location {
+	if s.schedule.Location != nil {
+		return s.schedule.Location
+	}
+	return time.Local
+}
+
+// Works out the limits for now and sets them on the limiters. The lock must be held.
+func (s *Scheduler) apply(now time.Time) {
+	now = now.In(s.location())
+	var (
+		active   []string
+		limits   Limits
+		altSpeed bool
+	)
+	for _, r := range s.schedule.Rules {
+		if !r.activeAt(now) {
+			continue
+		}
+		active = append(active, r.Name)
+		limits = limits.overlay(r.Limits)
+		altSpeed = altSpeed || r.AltSpeed
+	}
+	if !slices.Equal(active, s.active) {
+		s.altSpeedOverride.SetNone()
+	}
+	s.altSpeed = s.altSpeedOverride.UnwrapOr(altSpeed)
+	if s.altSpeed {
+		limits = limits.overlay(s.schedule.AltSpeedLimits)
+	}
+	s.active = active
+	s.nextChange = s.nextChangeAfter(now)
+	s.setLimits(s.original.overlay(limits))
+}
+
+// Default bursts for finite rates on limiters that had none, like the unlimited defaults in
+// torrent.ClientConfig. The byte burst fits a few of the usual 16 KiB chunks.
+const (
+	defaultByteBurst = 1 << 16
+	defaultDialBurst = 1
+)
+
+func (s *Scheduler) setLimits(limits Limits) {
+	setLimit(s.limiters.Upload, limits.Upload, s.original.Upload, defaultByteBurst)
+	setLimit(s.limiters.Download, limits.Download, s.original.Download, defaultByteBurst)
+	setLimit(s.limiters.Dial, limits.Dial, s.original.Dial, defaultDialBurst)
+}
+
+func setLimit(l *rate.Limiter, limit, original g.Option[Limit], defaultBurst int) {
+	if l == nil || !limit.Ok {
+		return
+	}
+	burst := limit.Value.Burst
+	if burst == 0 {
+		burst = original.Value.Burst
+		if limit.Value.Rate != rate.Inf {
+			burst = max(burst, defaultBurst)
+		}
+	}
+	now := time.Now()
+	setBurst := func() {
+		if l.Burst() != burst {
+			l.SetBurstAt(now, burst)
+		}
+	}
+	// Order the changes so a finite rate is never seen without its burst.
+	if limit.Value.Rate == rate.Inf {
+		defer setBurst()
+	} else {
+		setBurst()
+	}
+	if l.Limit() != limit.Value.Rate {
+		l.SetLimitAt(now, limit.Value.Rate)
+	}
+}
+
+// Returns a copy of me with the limits set in other replacing its own.
+func (me Limits) overlay(other Limits) Limits {
+	if other.Upload.Ok {
+		me.Upload = other.Upload
+	}
+	if other.Download.Ok {
+		me.Download = other.Download
+	}
+	if other.Dial.Ok {
+		me.Dial = other.Dial
+	}
+	return me
+}
+
+// Returns the time the wall clock shows offset past midnight, days after t's date. Offsets are
+// wall clock times, so they stay put on days the clocks change.
+func atOffset(t time.Time, days int, offset time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+days, 0, 0, int(offset/time.Second), int(offset%time.Second), t.Location())
+}
+
+func midnight(t time.Time, days int) time.Time {
+	return atOffset(t, days, 0)
+}
+
+// Returns how far t's wall clock is past midnight.
+func clockOffset(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+func (r Rule) onDay(day time.Weekday) bool {
+	return len(r.Days) == 0 || slices.Contains(r.Days, day)
+}
+
+func (r Rule) activeAt(t time.Time) bool {
+	today := midnight(t, 0)
+	offset := clockOffset(t)
+	switch {
+	case r.Start == r.End:
+		return r.onDay(today.Weekday())
+	case r.Start < r.End:
+		return r.onDay(today.Weekday()) && offset >= r.Start && offset < r.End
+	default:
+		return r.onDay(today.Weekday()) && offset >= r.Start ||
+			r.onDay(midnight(t, -1).Weekday()) && offset < r.End
+	}
+}
+
+// Returns the earliest time after now that a rule could start or stop applying.
+func (s *Scheduler) nextChangeAfter(now time.Time) (next time.Time) {
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for day := 0; day <= 1; day++ {
+		consider(midnight(now, day))
+		for _, r := range s.schedule.Rules {
+			consider(atOffset(now, day, r.Start))
+			consider(atOffset(now, day, r.End))
+		}
+	}
+	return
+}
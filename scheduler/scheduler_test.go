@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/time/rate"
+
+	"github.com/anacrolix/torrent"
+)
+
+func TestRuleActiveAt(t *testing.T) {
+	c := qt.New(t)
+	// A Monday.
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC)
+	}
+	office := Rule{
+		Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+	}
+	c.Check(office.activeAt(at(1, 9)), qt.IsTrue)
+	c.Check(office.activeAt(at(1, 17)), qt.IsFalse)
+	c.Check(office.activeAt(at(6, 12)), qt.IsFalse)
+	night := Rule{
+		Days:  []time.Weekday{time.Friday},
+		Start: 22 * time.Hour,
+		End:   6 * time.Hour,
+	}
+	c.Check(night.activeAt(at(5, 23)), qt.IsTrue)
+	c.Check(night.activeAt(at(6, 5)), qt.IsTrue)
+	c.Check(night.activeAt(at(6, 6)), qt.IsFalse)
+	c.Check(night.activeAt(at(1, 5)), qt.IsFalse)
+	c.Check(Rule{}.activeAt(at(3, 0)), qt.IsTrue)
+}
+
+func TestRuleClockChanges(t *testing.T) {
+	c := qt.New(t)
+	loc, err := time.LoadLocation("Europe/London")
+	c.Assert(err, qt.IsNil)
+	office := Rule{
+		Name:  "office",
+		Start: 9 * time.Hour,
+		End:   17 * time.Hour,
+	}
+	s := &Scheduler{schedule: Schedule{Rules: []Rule{office}}}
+	// The clocks go forward at 01:00 on 2024-03-31, and back at 02:00 on 2024-10-27.
+	for _, day := range []time.Time{
+		time.Date(2024, time.March, 31, 0, 0, 0, 0, loc),
+		time.Date(2024, time.October, 27, 0, 0, 0, 0, loc),
+	} {
+		at := func(hour, min int) time.Time {
+			return time.Date(day.Year(), day.Month(), day.Day(), hour, min, 0, 0, loc)
+		}
+		c.Check(office.activeAt(at(8, 59)), qt.IsFalse)
+		c.Check(office.activeAt(at(9, 0)), qt.IsTrue)
+		c.Check(office.activeAt(at(16, 59)), qt.IsTrue)
+		c.Check(office.activeAt(at(17, 0)), qt.IsFalse)
+		c.Check(s.nextChangeAfter(at(3, 0)), qt.Equals, at(9, 0))
+		c.Check(s.nextChangeAfter(at(9, 0)), qt.Equals, at(17, 0))
+	}
+}
+
+func TestSchedulerApply(t *testing.T) {
+	c := qt.New(t)
+	up := rate.NewLimiter(rate.Inf, 1<<16)
+	down := rate.NewLimiter(1000, 1<<16)
+	s := New(Limiters{Upload: up, Download: down}, Schedule{
+		Rules: []Rule{{
+			Name:   "office",
+			Start:  9 * time.Hour,
+			End:    17 * time.Hour,
+			Limits: Limits{Upload: g.Some(Limit{Rate: 100})},
+		}, {
+			Name:     "lunch",
+			Start:    12 * time.Hour,
+			End:      13 * time.Hour,
+			AltSpeed: true,
+		}},
+		AltSpeedLimits: Limits{Download: g.Some(Limit{Rate: 10, Burst: 1 << 14})},
+		Location:       time.UTC,
+	})
+	defer func() {
+		s.Close()
+		c.Check(up.Limit(), qt.Equals, rate.Inf)
+		c.Check(down.Limit(), qt.Equals, rate.Limit(1000))
+	}()
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 1, hour, 0, 0, 0, time.UTC)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apply(at(8))
+	c.Check(up.Limit(), qt.Equals, rate.Inf)
+	c.Check(s.nextChange, qt.Equals, at(9))
+
+	s.apply(at(10))
+	c.Check(up.Limit(), qt.Equals, rate.Limit(100))
+	c.Check(up.Burst(), qt.Equals, 1<<16)
+	c.Check(down.Limit(), qt.Equals, rate.Limit(1000))
+	c.Check(s.altSpeed, qt.IsFalse)
+
+	s.apply(at(12))
+	c.Check(s.altSpeed, qt.IsTrue)
+	c.Check(down.Limit(), qt.Equals, rate.Limit(10))
+	c.Check(down.Burst(), qt.Equals, 1<<14)
+	var buf bytes.Buffer
+	s.mu.Unlock()
+	s.WriteStatus(&buf)
+	s.mu.Lock()
+	c.Check(buf.String(), qt.Contains, "active rules: office, lunch, alt speed: true")
+
+	// A manual override lasts until the active rules change.
+	s.altSpeedOverride.Set(false)
+	s.apply(at(12))
+	c.Check(down.Limit(), qt.Equals, rate.Limit(1000))
+	s.apply(at(13))
+	c.Check(s.altSpeedOverride.Ok, qt.IsFalse)
+	s.apply(at(18))
+	c.Check(up.Limit(), qt.Equals, rate.Inf)
+	c.Check(down.Limit(), qt.Equals, rate.Limit(1000))
+	c.Check(down.Burst(), qt.Equals, 1<<16)
+}
+
+func TestSchedulerDefaultClientConfig(t *testing.T) {
+	c := qt.New(t)
+	cfg := torrent.NewDefaultClientConfig()
+	up := cfg.UploadRateLimiter
+	dial := cfg.DialRateLimiter
+	s := New(Limiters{Upload: up, Download: cfg.DownloadRateLimiter, Dial: dial}, Schedule{
+		Rules: []Rule{{
+			Limits: Limits{
+				Upload: g.Some(Limit{Rate: 100}),
+				Dial:   g.Some(Limit{Rate: 1}),
+			},
+		}},
+	})
+	// The unlimited default has no burst, which would stop everything at a finite rate.
+	c.Check(up.Limit(), qt.Equals, rate.Limit(100))
+	c.Check(up.Burst(), qt.Equals, defaultByteBurst)
+	c.Check(up.ReserveN(time.Now(), 16<<10).OK(), qt.IsTrue)
+	c.Check(cfg.DownloadRateLimiter.Limit(), qt.Equals, rate.Inf)
+	c.Check(dial.Limit(), qt.Equals, rate.Limit(1))
+	c.Check(dial.Burst(), qt.Equals, 10)
+	s.Close()
+	c.Check(up.Limit(), qt.Equals, rate.Inf)
+	c.Check(up.Burst(), qt.Equals, 0)
+}
@@ -0,0 +1,207 @@
+package torrent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+)
+
+// How often seeding torrents are checked against their SeedLimits. Seeding and idle times are
+// sampled at this granularity.
+const seedLimitsCheckInterval = 10 * time.Second
+
+// What to do with a Torrent when it reaches one of its SeedLimits.
+type SeedLimitAction int
+
+const (
+	// Stop uploading, as with Torrent.DisallowDataUpload.
+	SeedLimitActionDisallowDataUpload SeedLimitAction = iota
+	// Stop all network activity, as with Torrent.Pause.
+	SeedLimitActionPause
+	// Remove the Torrent from the Client, as with Torrent.Drop.
+	SeedLimitActionDrop
+)
+
+func (me SeedLimitAction) String() string {
+	switch me {
+	case SeedLimitActionDisallowDataUpload:
+		return "disallow data upload"
+	case SeedLimitActionPause:
+		return "pause"
+	case SeedLimitActionDrop:
+		return "drop"
+	default:
+		return fmt.Sprintf("SeedLimitAction(%d)", int(me))
+	}
+}
+
+// Limits on how long a Torrent seeds once it has all the data it wants. Zero values mean no limit.
+type SeedLimits struct {
+	// Maximum ratio of ConnStats.BytesWrittenData to ConnStats.BytesReadUsefulData. If nothing was
+	// downloaded, the torrent's length is used instead.
+	MaxRatio float64
+	// Maximum time spent actively seeding.
+	MaxSeedTime time.Duration
+	// Maximum time spent actively seeding without uploading any data.
+	MaxIdleSeedTime time.Duration
+	Action          SeedLimitAction
+}
+
+// The limit that was reached in a SeedLimitReachedEvent.
+type SeedLimitReason int
+
+const (
+	SeedLimitReasonRatio SeedLimitReason = iota
+	SeedLimitReasonSeedTime
+	SeedLimitReasonIdleSeedTime
+)
+
+func (me SeedLimitReason) String() string {
+	switch me {
+	case SeedLimitReasonRatio:
+		return "ratio"
+	case SeedLimitReasonSeedTime:
+		return "seed time"
+	case SeedLimitReasonIdleSeedTime:
+		return "idle seed time"
+	default:
+		return fmt.Sprintf("SeedLimitReason(%d)", int(me))
+	}
+}
+
+type SeedLimitReachedEvent struct {
+	Torrent *Torrent
+	Reason  SeedLimitReason
+	Action  SeedLimitAction
+}
+
+// Overrides ClientConfig.SeedLimits for this Torrent. This also rearms the limits if they were
+// reached before.
+func (t *Torrent) SetSeedLimits(limits SeedLimits) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.seedLimits.Set(limits)
+	t.seedLimitReached = false
+}
+
+// Reverts to ClientConfig.SeedLimits.
+func (t *Torrent) ClearSeedLimits() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.seedLimits.SetNone()
+	t.seedLimitReached = false
+}
+
+// Returns the time the Torrent has spent actively seeding.
+func (t *Torrent) SeedTime() time.Duration {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.seedTime
+}
+
+func (t *Torrent) effectiveSeedLimits() SeedLimits {
+	return t.seedLimits.UnwrapOr(t.cl.config.SeedLimits)
+}
+
+// Whether the Torrent has everything it wants and is uploading.
+func (t *Torrent) activelySeeding() bool {
+	return t.haveInfo() && !t.needData() && t.seeding() && t.networkingEnabled.Bool()
+}
+
+func (t *Torrent) seedRatio() float64 {
+	downloaded := t.stats.BytesReadUsefulData.Int64()
+	if downloaded == 0 {
+		downloaded = t.length()
+	}
+	if downloaded == 0 {
+		return 0
+	}
+	return float64(t.stats.BytesWrittenData.Int64()) / float64(downloaded)
+}
+
+// Accumulates seeding and idle time since the last check, and returns the limit that was reached,
+// if any.
+func (t *Torrent) updateSeedLimits(elapsed time.Duration) (reason g.Option[SeedLimitReason]) {
+	uploaded := t.stats.BytesWrittenData.Int64()
+	if uploaded != t.seedLimitsLastUploaded {
+		t.seedLimitsLastUploaded = uploaded
+		t.seedIdleTime = 0
+	} else if t.activelySeeding() {
+		t.seedIdleTime += elapsed
+	}
+	if !t.activelySeeding() {
+		return
+	}
+	t.seedTime += elapsed
+	if t.seedLimitReached {
+		return
+	}
+	limits := t.effectiveSeedLimits()
+	switch {
+	case limits.MaxRatio > 0 && t.seedRatio() >= limits.MaxRatio:
+		reason.Set(SeedLimitReasonRatio)
+	case limits.MaxSeedTime > 0 && t.seedTime >= limits.MaxSeedTime:
+		reason.Set(SeedLimitReasonSeedTime)
+	case limits.MaxIdleSeedTime > 0 && t.seedIdleTime >= limits.MaxIdleSeedTime:
+		reason.Set(SeedLimitReasonIdleSeedTime)
+	}
+	return
+}
+
+// Checks all torrents against their seed limits, and applies the configured action to those that
+// reached them. The Client lock must be held. Torrents that are dropped are added to wg, which
+// should be waited on after the lock is released.
+func (cl *Client) checkSeedLimits(elapsed time.Duration, wg *sync.WaitGroup) {
+	for _, t := range cl.torrentsAsSlice() {
+		reached := t.updateSeedLimits(elapsed)
+		if !reached.Ok {
+			continue
+		}
+		reason := reached.Value
+		t.seedLimitReached = true
+		action := t.effectiveSeedLimits().Action
+		t.logger.Levelf(log.Info, "reached seed limit %v, applying action %v", reason, action)
+		ev := SeedLimitReachedEvent{
+			Torrent: t,
+			Reason:  reason,
+			Action:  action,
+		}
+		for _, f := range cl.config.Callbacks.SeedLimitReached {
+			f(ev)
+		}
+		cl.publishEvent(ev)
+		switch action {
+		case SeedLimitActionDisallowDataUpload:
+			t.disallowDataUpload()
+		case SeedLimitActionPause:
+			t.paused = true
+			t.updateNetworkingEnabled("seed limit reached")
+			cl.queueChanged()
+		case SeedLimitActionDrop:
+			err := cl.dropTorrent(t, wg)
+			if err != nil {
+				t.logger.Levelf(log.Warning, "error dropping torrent after reaching seed limit: %v", err)
+			}
+		}
+	}
+}
+
+func (cl *Client) seedLimitsChecker() {
+	last := time.Now()
+	for {
+		select {
+		case <-cl.closed.Done():
+			return
+		case now := <-time.After(seedLimitsCheckInterval):
+			var wg sync.WaitGroup
+			cl.lock()
+			cl.checkSeedLimits(now.Sub(last), &wg)
+			cl.unlock()
+			wg.Wait()
+			last = now
+		}
+	}
+}
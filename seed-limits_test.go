@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestSeedLimits(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = dir
+	var events []SeedLimitReachedEvent
+	cfg.Callbacks.SeedLimitReached = append(cfg.Callbacks.SeedLimitReached, func(e SeedLimitReachedEvent) {
+		events = append(events, e)
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Assert(tt.Seeding(), qt.IsTrue)
+
+	check := func(elapsed time.Duration) {
+		var wg sync.WaitGroup
+		cl.lock()
+		cl.checkSeedLimits(elapsed, &wg)
+		cl.unlock()
+		wg.Wait()
+	}
+
+	tt.SetSeedLimits(SeedLimits{MaxRatio: 0.5})
+	check(time.Second)
+	c.Check(events, qt.HasLen, 0)
+	tt.stats.BytesWrittenData.Add(tt.Length())
+	check(time.Second)
+	c.Assert(events, qt.HasLen, 1)
+	c.Check(events[0].Reason, qt.Equals, SeedLimitReasonRatio)
+	c.Check(events[0].Action, qt.Equals, SeedLimitActionDisallowDataUpload)
+	c.Check(tt.Seeding(), qt.IsFalse)
+	// Limits only trigger once.
+	check(time.Second)
+	c.Check(events, qt.HasLen, 1)
+
+	tt.AllowDataUpload()
+	tt.SetSeedLimits(SeedLimits{MaxSeedTime: time.Minute, Action: SeedLimitActionPause})
+	check(time.Minute)
+	c.Assert(events, qt.HasLen, 2)
+	c.Check(events[1].Reason, qt.Equals, SeedLimitReasonSeedTime)
+	c.Check(tt.Paused(), qt.IsTrue)
+	c.Check(tt.SeedTime() >= time.Minute, qt.IsTrue)
+
+	tt.Resume()
+	tt.SetSeedLimits(SeedLimits{MaxIdleSeedTime: time.Minute, Action: SeedLimitActionDrop})
+	// Uploading resets the idle time.
+	tt.stats.BytesWrittenData.Add(1)
+	check(30 * time.Second)
+	check(30 * time.Second)
+	c.Check(events, qt.HasLen, 2)
+	check(30 * time.Second)
+	c.Assert(events, qt.HasLen, 3)
+	c.Check(events[2].Reason, qt.Equals, SeedLimitReasonIdleSeedTime)
+	c.Check(cl.Torrents(), qt.HasLen, 0)
+}
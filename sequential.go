@@ -0,0 +1,126 @@
+package torrent
+
+// Requests the Torrent's wanted pieces in increasing index order instead of rarest first. Pieces
+// with reader priorities above PiecePriorityNormal are still requested first. See
+// SetSequentialWindow to limit how far ahead pieces are requested.
+func (t *Torrent) SetSequential(on bool) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if t.sequential == on {
+		return
+	}
+	t.sequential = on
+	t.sequentialChanged("Torrent.SetSequential")
+}
+
+// Returns whether sequential mode was set with SetSequential.
+func (t *Torrent) Sequential() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.sequential
+}
+
+// Sets how many wanted, incomplete sequential pieces are requested at once, counting from the
+// lowest index. Later pieces are requested as earlier ones complete. Zero means there is no window,
+// and sequential pieces are only ordered by index.
+func (t *Torrent) SetSequentialWindow(pieces int) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if t.sequentialWindow == pieces {
+		return
+	}
+	t.sequentialWindow = pieces
+	t.sequentialChanged("Torrent.SetSequentialWindow")
+}
+
+// Requests the File's pieces in sequential order. This is the per-file counterpart of
+// Torrent.SetSequential, and shares the Torrent's sequential window.
+func (f *File) SetSequential(on bool) {
+	f.t.cl.lock()
+	defer f.t.cl.unlock()
+	if f.sequential == on {
+		return
+	}
+	f.sequential = on
+	f.t.sequentialChanged("File.SetSequential")
+}
+
+// Returns whether sequential mode was set with File.SetSequential.
+func (f *File) Sequential() bool {
+	f.t.cl.rLock()
+	defer f.t.cl.rUnlock()
+	return f.sequential
+}
+
+func (t *Torrent) pieceSequential(i pieceIndex) bool {
+	if t.sequential {
+		return true
+	}
+	for _, f := range t.piece(i).files {
+		if f.sequential {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the index after the last piece in the sequential window.
+func (t *Torrent) computeSequentialWindowEnd() pieceIndex {
+	if t.sequentialWindow <= 0 || !t.haveInfo() {
+		return t.numPieces()
+	}
+	n := 0
+	end := t.numPieces()
+	t._pendingPieces.Iterate(func(x uint32) bool {
+		i := pieceIndex(x)
+		if !t.pieceSequential(i) {
+			return true
+		}
+		n++
+		if n < t.sequentialWindow {
+			return true
+		}
+		end = i + 1
+		return false
+	})
+	return end
+}
+
+// Whether the piece is held back from requests until the sequential window reaches it.
+func (t *Torrent) pieceOutsideSequentialWindow(i pieceIndex) bool {
+	return t.sequentialWindow > 0 &&
+		i >= t.sequentialWindowEnd &&
+		t.pieceSequential(i) &&
+		t.piece(i).purePriority() <= PiecePriorityNormal
+}
+
+// Moves the sequential window after pending pieces change.
+func (t *Torrent) updateSequentialWindow(reason string) {
+	end := t.computeSequentialWindowEnd()
+	begin := t.sequentialWindowEnd
+	if end == begin {
+		return
+	}
+	t.sequentialWindowEnd = end
+	if begin > end {
+		begin, end = end, begin
+	}
+	for i := begin; i < end; i++ {
+		t.updatePieceRequestOrderPiece(i)
+	}
+	t.iterPeers(func(p *Peer) {
+		p.updateRequests(reason)
+	})
+}
+
+// Recalculates piece ordering after sequential settings change.
+func (t *Torrent) sequentialChanged(reason string) {
+	if !t.haveInfo() {
+		return
+	}
+	t.sequentialWindowEnd = t.computeSequentialWindowEnd()
+	t.updateAllPiecePriorities(reason)
+	t.iterPeers(func(p *Peer) {
+		p.updateRequests(reason)
+	})
+}
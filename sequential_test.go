@@ -0,0 +1,50 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestSequentialWindow(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	info := testutil.Greeting.Info(1)
+	mi := metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(&mi)
+	c.Assert(err, qt.IsNil)
+	for i := range tt.NumPieces() {
+		tt.Piece(i).SetPriority(PiecePriorityNormal)
+	}
+	tt.SetSequentialWindow(3)
+	requestable := func() (ret []int) {
+		tt.cl.rLock()
+		defer tt.cl.rUnlock()
+		for i := range tt.numPieces() {
+			if !tt.ignorePieceForRequests(i) {
+				ret = append(ret, i)
+			}
+		}
+		return
+	}
+	// The window only applies in sequential mode.
+	c.Check(requestable(), qt.HasLen, tt.NumPieces())
+	tt.SetSequential(true)
+	c.Check(requestable(), qt.DeepEquals, []int{0, 1, 2})
+	c.Check(tt.requestStrategyPieceOrderState(5).Sequential, qt.IsTrue)
+
+	// Pieces that are no longer wanted move the window along.
+	tt.Piece(1).SetPriority(PiecePriorityNone)
+	c.Check(requestable(), qt.DeepEquals, []int{0, 2, 3})
+
+	// Reader priorities aren't held back.
+	tt.Piece(7).SetPriority(PiecePriorityNow)
+	c.Check(requestable(), qt.DeepEquals, []int{0, 2, 3, 7})
+}
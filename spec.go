@@ -30,6 +30,9 @@ type TorrentSpec struct {
 	PeerAddrs []string
 	// The combination of the "xs" and "as" fields in magnet links, for now.
 	Sources []string
+	// The files to download from a magnet link "so" field (BEP 53). When the info is available,
+	// these files are given normal priority, and the others none.
+	SelectOnly []metainfo.FileIndexRange
 	// BEP 52 "piece layers" from metainfo
 	PieceLayers map[string]string
 
@@ -59,6 +62,7 @@ func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
 		Webseeds:    m.Params["ws"],
 		Sources:     append(m.Params["xs"], m.Params["as"]...),
 		PeerAddrs:   m.Params["x.pe"], // BEP 9
+		SelectOnly:  m.SelectOnly,
 		// TODO: What's the parameter for DHT nodes?
 	}
 	return
@@ -92,6 +92,16 @@ func (me boltPieceCompletion) Set(pk metainfo.PieceKey, b bool) error {
 	})
 }
 
+func (me boltPieceCompletion) DeleteTorrent(ih metainfo.Hash) error {
+	return me.db.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(completionBucketKey)
+		if c == nil || c.Bucket(ih[:]) == nil {
+			return nil
+		}
+		return c.DeleteBucket(ih[:])
+	})
+}
+
 func (me *boltPieceCompletion) Close() error {
 	return me.db.Close()
 }
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Optionally implemented by a PieceCompletion to forget all the pieces of a torrent.
+type PieceCompletionTorrentDeleter interface {
+	DeleteTorrent(infoHash metainfo.Hash) error
+}
+
+func deleteTorrentPieceCompletion(pc PieceCompletionGetSetter, infoHash metainfo.Hash) error {
+	d, ok := pc.(PieceCompletionTorrentDeleter)
+	if !ok {
+		return fmt.Errorf("piece completion %T does not support deleting torrents", pc)
+	}
+	return d.DeleteTorrent(infoHash)
+}
+
+// Removes the files, and then directories left empty beneath dir. Files that aren't beneath dir
+// are never touched.
+func deleteFiles(files []file, dir string) error {
+	var errs []error
+	for _, f := range files {
+		if !isSubFilepath(dir, f.path) {
+			errs = append(errs, fmt.Errorf("file %q is not beneath %q", f.path, dir))
+			continue
+		}
+		err := os.Remove(f.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removeEmptyDirs(filepath.Dir(f.path), dir)
+	}
+	return errors.Join(errs...)
+}
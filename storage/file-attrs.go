@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (f file) isSymlink() bool {
+	return f.symlinkTarget != ""
+}
+
+// Rejects files and symlink targets whose paths pass through one of the torrent's symlinks, as
+// they could end up anywhere the symlink leads.
+func checkFilesNotBeneathSymlinks(dir string, files []file) error {
+	dir = filepath.Clean(dir)
+	symlinks := make(map[string]struct{})
+	for _, f := range files {
+		if f.isSymlink() {
+			symlinks[f.path] = struct{}{}
+		}
+	}
+	if len(symlinks) == 0 {
+		return nil
+	}
+	check := func(i int, path string) error {
+		for p := filepath.Dir(path); p != dir && isSubFilepath(dir, p); p = filepath.Dir(p) {
+			if _, ok := symlinks[p]; ok {
+				return fmt.Errorf("file %v: path %q is beneath symlink %q", i, path, p)
+			}
+		}
+		return nil
+	}
+	for i, f := range files {
+		err := check(i, f.path)
+		if err == nil && f.isSymlink() {
+			err = check(i, f.symlinkTarget)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Creates the symlink for a file with the BEP 47 symlink attribute in the torrent directory dir.
+// The target is relative so it survives the torrent being moved. It's computed from where the
+// symlink's directory really is, which must still be within dir.
+func createFileSymlink(dir string, f file) error {
+	err := os.MkdirAll(filepath.Dir(f.path), 0o777)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(f.path))
+	if err != nil {
+		return err
+	}
+	if !isSubFilepath(realDir, realParent) {
+		return fmt.Errorf("symlink directory %q resolves outside %q", filepath.Dir(f.path), dir)
+	}
+	relTarget, err := filepath.Rel(dir, f.symlinkTarget)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Rel(realParent, filepath.Join(realDir, relTarget))
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(realParent, filepath.Base(f.path))
+	if existing, err := os.Readlink(name); err == nil && existing == target {
+		return nil
+	}
+	// Replace whatever is there, like a zero-length file from before symlinks were supported.
+	os.Remove(name)
+	return os.Symlink(target, name)
+}
+
+// Returns the piece whose completion creates the symlink: the piece at its offset, or the last piece
+// if it's at the end of the data. Returns -1 if the torrent has no data.
+func symlinkPiece(f file, pieceLength, end int64) int {
+	if end == 0 {
+		return -1
+	}
+	return int(min(f.offset, end-1) / pieceLength)
+}
+
+// Creates the symlinks that complete with the piece. The lock must be held.
+func (fts *fileTorrentImpl) createSymlinks(piece int) error {
+	for _, i := range fts.symlinks[piece] {
+		dir := fts.dir
+		if fts.fileInCompletedDir(i) {
+			dir = fts.completedDir
+		}
+		err := createFileSymlink(dir, fts.files[i])
+		if err != nil {
+			return fmt.Errorf("creating symlink: %w", err)
+		}
+	}
+	return nil
+}
+
+// Adds execute permission for everyone that can read the file.
+func setFileExecutable(name string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	perm := fi.Mode().Perm()
+	return os.Chmod(name, perm|(perm&0o444)>>2)
+}
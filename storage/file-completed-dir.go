@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+)
+
+// Whether the file has been moved to the completed directory. The lock must be held.
+func (fts *fileTorrentImpl) fileInCompletedDir(i int) bool {
+	return fts.completedFiles != nil && fts.files[i].path == fts.completedFiles[i].path
+}
+
+// Whether all the pieces that overlap the file are complete.
+func (fts *fileTorrentImpl) fileComplete(f file) bool {
+	pieceLength := fts.info.PieceLength
+	begin := int(f.offset / pieceLength)
+	end := int((f.offset + f.length + pieceLength - 1) / pieceLength)
+	for i := begin; i < end; i++ {
+		c, err := fts.completion.Get(metainfo.PieceKey{InfoHash: fts.infoHash, Index: i})
+		if err != nil || !c.Complete {
+			return false
+		}
+	}
+	return true
+}
+
+// Finishes files overlapping the piece if they're now complete: Executable files get their
+// permissions, and files are moved to the completed directory. Symlinks at the piece are created.
+func (fts *fileTorrentImpl) finishCompletedFiles(p metainfo.Piece) error {
+	if !fts.finishFiles {
+		return nil
+	}
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	var errs []error
+	fts.segmentLocater.Locate(segments.Extent{
+		Start:  p.Offset(),
+		Length: p.Length(),
+	}, func(i int, _ segments.Extent) bool {
+		f := fts.files[i]
+		if !f.executable && fts.completedFiles == nil {
+			return true
+		}
+		if fts.fileInCompletedDir(i) || !fts.fileComplete(f) {
+			return true
+		}
+		if f.executable {
+			err := setFileExecutable(f.path)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if fts.completedFiles == nil {
+			return true
+		}
+		to := fts.completedFiles[i].path
+		mv, err := moveFiles(context.Background(), []fileMove{{
+			from:   f.path,
+			to:     to,
+			length: f.length,
+		}}, nil)
+		if err != nil {
+			errs = append(errs, err)
+			return true
+		}
+		mv.commitLoggingErr(fts.dir)
+		fts.files[i].path = to
+		return true
+	})
+	errs = append(errs, fts.createSymlinks(p.Index()))
+	return errors.Join(errs...)
+}
+
+// Moves files overlapping the piece back from the completed directory, as they're no longer
+// complete.
+func (fts *fileTorrentImpl) unfinishFiles(p metainfo.Piece) error {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	if fts.completedFiles == nil {
+		return nil
+	}
+	var incompleteFiles []file
+	var errs []error
+	fts.segmentLocater.Locate(segments.Extent{
+		Start:  p.Offset(),
+		Length: p.Length(),
+	}, func(i int, _ segments.Extent) bool {
+		f := fts.files[i]
+		// Files without data are always complete.
+		if f.length == 0 || !fts.fileInCompletedDir(i) {
+			return true
+		}
+		if incompleteFiles == nil {
+			var err error
+			_, incompleteFiles, err = fts.client.torrentFiles(fts.baseDir, fts.info, fts.infoHash, fts.renames)
+			if err != nil {
+				errs = append(errs, err)
+				return false
+			}
+		}
+		to := incompleteFiles[i].path
+		mv, err := moveFiles(context.Background(), []fileMove{{
+			from:   f.path,
+			to:     to,
+			length: f.length,
+		}}, nil)
+		if err != nil {
+			errs = append(errs, err)
+			return true
+		}
+		mv.commitLoggingErr(fts.completedDir)
+		fts.files[i].path = to
+		return true
+	})
+	return errors.Join(errs...)
+}
@@ -32,12 +32,17 @@ func (fs *filePieceImpl) Completion() Completion {
 
 	verified := true
 	if c.Complete {
+		fs.mu.RLock()
+		defer fs.mu.RUnlock()
 		// If it's allegedly complete, check that its constituent files have the necessary length.
 		if !fs.segmentLocater.Locate(segments.Extent{
 			Start:  fs.p.Offset(),
 			Length: fs.p.Length(),
 		}, func(i int, extent segments.Extent) bool {
 			file := fs.files[i]
+			if file.isSymlink() {
+				return true
+			}
 			s, err := os.Stat(file.path)
 			if err != nil || s.Size() < extent.Start+extent.Length {
 				verified = false
@@ -59,9 +64,17 @@ func (fs *filePieceImpl) Completion() Completion {
 }
 
 func (fs *filePieceImpl) MarkComplete() error {
-	return fs.completion.Set(fs.pieceKey(), true)
+	err := fs.completion.Set(fs.pieceKey(), true)
+	if err != nil {
+		return err
+	}
+	return fs.finishCompletedFiles(fs.p)
 }
 
 func (fs *filePieceImpl) MarkNotComplete() error {
-	return fs.completion.Set(fs.pieceKey(), false)
+	err := fs.completion.Set(fs.pieceKey(), false)
+	if err != nil {
+		return err
+	}
+	return fs.unfinishFiles(fs.p)
 }
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Returns the info and file info as they would be if the file had the new path components. A
+// single-file torrent's file is named by the info, so the components replace the name.
+func renamedFileInfo(
+	info *metainfo.Info, fileInfo metainfo.FileInfo, components []string,
+) (*metainfo.Info, metainfo.FileInfo) {
+	if info.IsDir() {
+		fileInfo.Path = components
+		fileInfo.PathUtf8 = nil
+		return info, fileInfo
+	}
+	renamedInfo := *info
+	renamedInfo.Name = strings.Join(components, "/")
+	renamedInfo.NameUtf8 = ""
+	fileInfo.Path = nil
+	fileInfo.PathUtf8 = nil
+	return &renamedInfo, fileInfo
+}
+
+func (fts *fileTorrentImpl) RenameFiles(renames map[int][]string) error {
+	fts.mu.Lock()
+	defer fts.mu.Unlock()
+	newRenames := maps.Clone(fts.renames)
+	if newRenames == nil {
+		newRenames = make(map[int][]string, len(renames))
+	}
+	for i, components := range renames {
+		if i < 0 || i >= len(fts.files) {
+			return fmt.Errorf("file index %v out of range", i)
+		}
+		newRenames[i] = slices.Clone(components)
+	}
+	_, files, err := fts.client.torrentFiles(fts.baseDir, fts.info, fts.infoHash, newRenames)
+	if err != nil {
+		return err
+	}
+	var completedFiles []file
+	if fts.completedFiles != nil {
+		_, completedFiles, err = fts.client.torrentFiles(
+			fts.client.opts.CompletedDir, fts.info, fts.infoHash, newRenames)
+		if err != nil {
+			return err
+		}
+	}
+	var moves []fileMove
+	var emptyFiles []fileMove
+	for i := range renames {
+		from := fts.files[i].path
+		to := files[i].path
+		if fts.fileInCompletedDir(i) {
+			to = completedFiles[i].path
+		}
+		files[i].path = to
+		if from == to {
+			continue
+		}
+		m := fileMove{
+			from:   from,
+			to:     to,
+			length: files[i].length,
+		}
+		if m.length == 0 {
+			emptyFiles = append(emptyFiles, m)
+			continue
+		}
+		if _, err := os.Lstat(from); errors.Is(err, os.ErrNotExist) {
+			// Nothing written yet, or the storage was reopened after the file was renamed.
+			continue
+		}
+		moves = append(moves, m)
+	}
+	mv, err := moveFiles(context.Background(), moves, nil)
+	if err != nil {
+		return err
+	}
+	mv.commitLoggingErr(fts.dir)
+	for _, m := range emptyFiles {
+		err = CreateNativeZeroLengthFile(m.to)
+		if err != nil {
+			// Leave the files that were moved where they are.
+			err = fmt.Errorf("creating zero length file: %w", err)
+			break
+		}
+		os.Remove(m.from)
+	}
+	for _, m := range emptyFiles {
+		removeEmptyDirs(filepath.Dir(m.from), fts.dir)
+	}
+	if fts.completedDir != "" {
+		// Renames within the completed directory aren't cleaned up by the commit.
+		for _, m := range slices.Concat(mv.renamed, mv.copied, emptyFiles) {
+			removeEmptyDirs(filepath.Dir(m.from), fts.completedDir)
+		}
+	}
+	for i := range renames {
+		fts.files[i] = files[i]
+	}
+	fts.completedFiles = completedFiles
+	fts.renames = newRenames
+	return err
+}
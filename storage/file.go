@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
+	g "github.com/anacrolix/generics"
 	"github.com/anacrolix/missinggo/v2"
 
 	"github.com/anacrolix/torrent/common"
@@ -29,6 +33,10 @@ type NewFileClientOpts struct {
 	FilePathMaker   FilePathMaker
 	TorrentDirMaker TorrentDirFilePathMaker
 	PieceCompletion PieceCompletion
+	// If set, files are written under ClientBaseDir until all their pieces are complete, and then
+	// moved to the same relative path under CompletedDir. They're moved back if a piece becomes
+	// incomplete again.
+	CompletedDir string
 }
 
 // NewFileOpts creates a new ClientImplCloser that stores files using the OS native filesystem.
@@ -56,54 +64,189 @@ func (me fileClientImpl) Close() error {
 }
 
 func (fs fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (_ TorrentImpl, err error) {
-	dir := fs.opts.TorrentDirMaker(fs.opts.ClientBaseDir, info, infoHash)
-	upvertedFiles := info.UpvertedFiles()
-	files := make([]file, 0, len(upvertedFiles))
-	for i, fileInfo := range upvertedFiles {
-		filePath := filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
-			Info: info,
-			File: &fileInfo,
-		}))
-		if !isSubFilepath(dir, filePath) {
-			err = fmt.Errorf("file %v: path %q is not sub path of %q", i, filePath, dir)
+	dir, files, err := fs.torrentFiles(fs.opts.ClientBaseDir, info, infoHash, nil)
+	if err != nil {
+		return
+	}
+	var completedDir string
+	var completedFiles []file
+	if fs.opts.CompletedDir != "" {
+		completedDir, completedFiles, err = fs.torrentFiles(fs.opts.CompletedDir, info, infoHash, nil)
+		if err != nil {
 			return
 		}
-		f := file{
-			path:   filePath,
-			length: fileInfo.Length,
+		for i, f := range completedFiles {
+			// Zero-length files are trivially complete.
+			if _, statErr := os.Lstat(f.path); statErr == nil || f.length == 0 {
+				files[i] = f
+			}
 		}
-		if f.length == 0 {
+	}
+	var end int64
+	for _, f := range files {
+		end = max(end, f.offset+f.length)
+	}
+	anyExecutable := false
+	var symlinks map[int][]int
+	for i, f := range files {
+		anyExecutable = anyExecutable || f.executable
+		switch {
+		case f.isSymlink():
+			// Symlinks are created when the piece at their offset completes.
+			g.MakeMapIfNil(&symlinks)
+			piece := symlinkPiece(f, info.PieceLength, end)
+			symlinks[piece] = append(symlinks[piece], i)
+		case f.length == 0:
 			err = CreateNativeZeroLengthFile(f.path)
 			if err != nil {
 				err = fmt.Errorf("creating zero length file: %w", err)
 				return
 			}
 		}
-		files = append(files, f)
 	}
 	t := &fileTorrentImpl{
-		files,
-		segments.NewIndexFromSegments(common.TorrentOffsetFileSegments(info)),
-		infoHash,
-		fs.opts.PieceCompletion,
+		client:         fs,
+		info:           info,
+		baseDir:        fs.opts.ClientBaseDir,
+		dir:            dir,
+		files:          files,
+		completedDir:   completedDir,
+		completedFiles: completedFiles,
+		segmentLocater: segments.NewIndexFromSegments(common.TorrentOffsetFileSegments(info)),
+		infoHash:       infoHash,
+		completion:     fs.opts.PieceCompletion,
+		symlinks:       symlinks,
+		finishFiles:    anyExecutable || completedFiles != nil || symlinks != nil,
+	}
+	// Files completed before they were opened won't be finished by MarkComplete.
+	for _, f := range files {
+		if !f.executable || !t.fileComplete(f) {
+			continue
+		}
+		err = setFileExecutable(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			// The completion is stale, the file will be finished when it's completed again.
+			err = nil
+		}
+		if err != nil {
+			err = fmt.Errorf("setting file executable: %w", err)
+			return
+		}
+	}
+	for piece := range symlinks {
+		if piece != -1 {
+			c, _ := t.completion.Get(metainfo.PieceKey{InfoHash: infoHash, Index: piece})
+			if !c.Complete {
+				continue
+			}
+		}
+		err = t.createSymlinks(piece)
+		if err != nil {
+			return
+		}
 	}
 	return TorrentImpl{
-		Piece: t.Piece,
-		Close: t.Close,
+		Piece:                 t.Piece,
+		Close:                 t.Close,
+		Move:                  t.Move,
+		RenameFiles:           t.RenameFiles,
+		DeleteData:            t.DeleteData,
+		DeletePieceCompletion: t.DeletePieceCompletion,
 	}, nil
 }
 
+// Returns the torrent directory and files for the torrent under baseDir. renames are new path
+// components by file index, see TorrentImpl.RenameFiles.
+func (fs fileClientImpl) torrentFiles(
+	baseDir string, info *metainfo.Info, infoHash metainfo.Hash, renames map[int][]string,
+) (dir string, files []file, err error) {
+	dir = fs.opts.TorrentDirMaker(baseDir, info, infoHash)
+	upvertedFiles := info.UpvertedFiles()
+	files = make([]file, 0, len(upvertedFiles))
+	for i, fileInfo := range upvertedFiles {
+		fileTorrentInfo := info
+		if components, ok := renames[i]; ok {
+			fileTorrentInfo, fileInfo = renamedFileInfo(info, fileInfo, components)
+		}
+		var f file
+		f, err = fs.torrentFile(dir, fileTorrentInfo, i, fileInfo)
+		if err != nil {
+			return
+		}
+		files = append(files, f)
+	}
+	err = checkFilesNotBeneathSymlinks(dir, files)
+	return
+}
+
+func (fs fileClientImpl) torrentFile(dir string, info *metainfo.Info, i int, fileInfo metainfo.FileInfo) (file, error) {
+	filePath := filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
+		Info: info,
+		File: &fileInfo,
+	}))
+	if !isSubFilepath(dir, filePath) {
+		return file{}, fmt.Errorf("file %v: path %q is not sub path of %q", i, filePath, dir)
+	}
+	f := file{
+		path:       filePath,
+		length:     fileInfo.Length,
+		offset:     fileInfo.TorrentOffset,
+		executable: fileInfo.HasAttr(metainfo.FileAttrExecutable),
+	}
+	if fileInfo.HasAttr(metainfo.FileAttrSymlink) {
+		if fileInfo.Length != 0 {
+			// Symlinks are skipped for reads and writes, so they can't take up space in the torrent.
+			return file{}, fmt.Errorf("file %v: symlink has length %v", i, fileInfo.Length)
+		}
+		f.symlinkTarget = filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
+			Info: info,
+			File: &metainfo.FileInfo{Path: fileInfo.SymlinkPath},
+		}))
+		// Links to the root of the torrent's files or above could lead anywhere.
+		root := filepath.Join(dir, fs.opts.FilePathMaker(FilePathMakerOpts{
+			Info: info,
+			File: &metainfo.FileInfo{},
+		}))
+		if len(fileInfo.SymlinkPath) == 0 || !isSubFilepath(root, f.symlinkTarget) ||
+			filepath.Clean(f.symlinkTarget) == filepath.Clean(root) {
+			return file{}, fmt.Errorf("file %v: symlink target %q is not within %q", i, f.symlinkTarget, root)
+		}
+	}
+	return f, nil
+}
+
 type file struct {
 	// The safe, OS-local file path.
 	path   string
 	length int64
+	// Offset of the file within the torrent.
+	offset int64
+	// BEP 47 attributes. The symlink target is a safe, OS-local path.
+	executable    bool
+	symlinkTarget string
 }
 
 type fileTorrentImpl struct {
-	files          []file
+	client fileClientImpl
+	info   *metainfo.Info
+	// Guards the fields below that change when the torrent or its files are moved or renamed.
+	mu      sync.RWMutex
+	baseDir string
+	dir     string
+	files   []file
+	// Where files are moved when complete, per NewFileClientOpts.CompletedDir. nil if disabled.
+	completedDir   string
+	completedFiles []file
+	// New path components by file index, from RenameFiles.
+	renames        map[int][]string
 	segmentLocater segments.Index
 	infoHash       metainfo.Hash
 	completion     PieceCompletion
+	// File indexes of symlinks by the piece whose completion creates them, see symlinkPiece.
+	symlinks map[int][]int
+	// Whether any files are executable, symlinks or moved when complete, see finishCompletedFiles.
+	// It doesn't change, so it's read without the lock.
+	finishFiles bool
 }
 
 func (fts *fileTorrentImpl) Piece(p metainfo.Piece) PieceImpl {
@@ -122,6 +265,60 @@ func (fs *fileTorrentImpl) Close() error {
 	return nil
 }
 
+func (fs *fileTorrentImpl) Move(ctx context.Context, newDir string, progress func(MoveProgress)) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	dir, files, err := fs.client.torrentFiles(newDir, fs.info, fs.infoHash, fs.renames)
+	if err != nil {
+		return err
+	}
+	moves := make([]fileMove, 0, len(files))
+	for i, f := range files {
+		if fs.fileInCompletedDir(i) {
+			// Completed files stay where they are.
+			files[i] = fs.files[i]
+			continue
+		}
+		moves = append(moves, fileMove{
+			from:   fs.files[i].path,
+			to:     f.path,
+			length: f.length,
+		})
+	}
+	mv, err := moveFiles(ctx, moves, progress)
+	if err != nil {
+		return err
+	}
+	mv.commitLoggingErr(fs.dir)
+	fs.baseDir = newDir
+	fs.dir = dir
+	fs.files = files
+	return nil
+}
+
+func (fs *fileTorrentImpl) DeleteData() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var errs []error
+	for i, f := range fs.files {
+		dir := fs.dir
+		if fs.fileInCompletedDir(i) {
+			dir = fs.completedDir
+		}
+		errs = append(errs, deleteFiles([]file{f}, dir))
+	}
+	// The torrent directory might be specific to the torrent.
+	removeEmptyDirs(fs.dir, fs.baseDir)
+	if fs.completedDir != "" {
+		removeEmptyDirs(fs.completedDir, fs.client.opts.CompletedDir)
+	}
+	return errors.Join(errs...)
+}
+
+func (fs *fileTorrentImpl) DeletePieceCompletion() error {
+	return deleteTorrentPieceCompletion(fs.completion, fs.infoHash)
+}
+
 // A helper to create zero-length files which won't appear for file-orientated storage since no
 // writes will ever occur to them (no torrent data is associated with a zero-length file). The
 // caller should make sure the file name provided is safe/sanitized.
@@ -171,7 +368,12 @@ func (fst *fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 
 // Only returns EOF at the end of the torrent. Premature EOF is ErrUnexpectedEOF.
 func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
+	fst.fts.mu.RLock()
+	defer fst.fts.mu.RUnlock()
 	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(b))}, func(i int, e segments.Extent) bool {
+		if fst.fts.files[i].isSymlink() {
+			return true
+		}
 		n1, err1 := fst.readFileAt(fst.fts.files[i], b[:e.Length], e.Start)
 		n += n1
 		b = b[n1:]
@@ -185,8 +387,13 @@ func (fst fileTorrentImplIO) ReadAt(b []byte, off int64) (n int, err error) {
 }
 
 func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
+	fst.fts.mu.RLock()
+	defer fst.fts.mu.RUnlock()
 	// log.Printf("write at %v: %v bytes", off, len(p))
 	fst.fts.segmentLocater.Locate(segments.Extent{off, int64(len(p))}, func(i int, e segments.Extent) bool {
+		if fst.fts.files[i].isSymlink() {
+			return true
+		}
 		name := fst.fts.files[i].path
 		os.MkdirAll(filepath.Dir(name), 0o777)
 		var f *os.File
@@ -40,3 +40,283 @@ func TestShortFile(t *testing.T) {
 		t.Errorf("expected nil or EOF error from truncated piece, got %v", err)
 	}
 }
+
+func TestCompletedDir(t *testing.T) {
+	incomplete := t.TempDir()
+	completed := t.TempDir()
+	pc := NewMapPieceCompletion()
+	newClient := func() ClientImplCloser {
+		return NewFileOpts(NewFileClientOpts{
+			ClientBaseDir:   incomplete,
+			CompletedDir:    completed,
+			PieceCompletion: pc,
+		})
+	}
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 2,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 3},
+			{Path: []string{"b"}, Length: 1},
+			{Path: []string{"empty"}, Length: 0},
+		},
+	}
+	s := newClient()
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(completed, "d", "empty"))
+	p0 := ts.Piece(info.Piece(0))
+	_, err = p0.WriteAt([]byte("he"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p0.MarkComplete())
+	// "a" still has data in piece 1.
+	assert.FileExists(t, filepath.Join(incomplete, "d", "a"))
+	p1 := ts.Piece(info.Piece(1))
+	_, err = p1.WriteAt([]byte("yo"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p1.MarkComplete())
+	assert.NoFileExists(t, filepath.Join(incomplete, "d", "a"))
+	assert.NoDirExists(t, filepath.Join(incomplete, "d"))
+	b, err := os.ReadFile(filepath.Join(completed, "d", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "hey", string(b))
+	assert.FileExists(t, filepath.Join(completed, "d", "b"))
+	buf := make([]byte, 2)
+	_, err = p1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "yo", string(buf))
+	assert.True(t, p1.Completion().Complete)
+	// Reopening finds the completed files.
+	s = newClient()
+	ts, err = s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	p0 = ts.Piece(info.Piece(0))
+	assert.True(t, p0.Completion().Complete)
+	_, err = p0.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "he", string(buf))
+	// Files that are no longer complete go back to the incomplete dir.
+	require.NoError(t, ts.Piece(info.Piece(1)).MarkNotComplete())
+	assert.NoFileExists(t, filepath.Join(completed, "d", "a"))
+	assert.NoFileExists(t, filepath.Join(completed, "d", "b"))
+	assert.FileExists(t, filepath.Join(completed, "d", "empty"))
+	b, err = os.ReadFile(filepath.Join(incomplete, "d", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "hey", string(b))
+	assert.FileExists(t, filepath.Join(incomplete, "d", "b"))
+	_, err = p0.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "he", string(buf))
+	require.NoError(t, ts.Piece(info.Piece(1)).MarkComplete())
+	assert.FileExists(t, filepath.Join(completed, "d", "a"))
+	assert.NoDirExists(t, filepath.Join(incomplete, "d"))
+}
+
+func TestFileRenameFiles(t *testing.T) {
+	dir := t.TempDir()
+	pc := NewMapPieceCompletion()
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 2,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"junk", "a"}, Length: 2},
+			{Path: []string{"empty"}, Length: 0},
+			{Path: []string{"b"}, Length: 2},
+		},
+	}
+	open := func() TorrentImpl {
+		ts, err := NewFileOpts(NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: pc,
+		}).OpenTorrent(info, metainfo.Hash{})
+		require.NoError(t, err)
+		return ts
+	}
+	ts := open()
+	_, err := ts.Piece(info.Piece(0)).WriteAt([]byte("hi"), 0)
+	require.NoError(t, err)
+	renames := map[int][]string{0: {"a"}, 1: {"sub", "empty"}, 2: {"c"}}
+	require.NoError(t, ts.RenameFiles(renames))
+	b, err := os.ReadFile(filepath.Join(dir, "d", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(b))
+	assert.NoDirExists(t, filepath.Join(dir, "d", "junk"))
+	assert.FileExists(t, filepath.Join(dir, "d", "sub", "empty"))
+	assert.NoFileExists(t, filepath.Join(dir, "d", "empty"))
+	_, err = ts.Piece(info.Piece(1)).WriteAt([]byte("yo"), 0)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "d", "c"))
+	// Renaming again after reopening finds the data already in place.
+	ts = open()
+	require.NoError(t, ts.RenameFiles(renames))
+	buf := make([]byte, 2)
+	_, err = ts.Piece(info.Piece(0)).ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(buf))
+	assert.NoFileExists(t, filepath.Join(dir, "d", "empty"))
+}
+
+func TestFileDeleteData(t *testing.T) {
+	baseDir := t.TempDir()
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 2,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a", "b"}, Length: 2},
+			{Path: []string{"empty"}, Length: 0},
+		},
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "other"), nil, 0o666))
+	ts, err := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   baseDir,
+		TorrentDirMaker: infoHashPathMaker,
+		PieceCompletion: NewMapPieceCompletion(),
+	}).OpenTorrent(info, metainfo.Hash{1})
+	require.NoError(t, err)
+	_, err = ts.Piece(info.Piece(0)).WriteAt([]byte("hi"), 0)
+	require.NoError(t, err)
+	require.NoError(t, ts.Close())
+	require.NoError(t, ts.DeleteData())
+	entries, err := os.ReadDir(baseDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "other", entries[0].Name())
+}
+
+func TestFileAttrs(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: NewMapPieceCompletion(),
+	})
+	defer s.Close()
+	symlink := func(target ...string) metainfo.ExtendedFileAttrs {
+		return metainfo.ExtendedFileAttrs{Attr: "l", SymlinkPath: target}
+	}
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 2,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"a"}, Length: 3, ExtendedFileAttrs: metainfo.ExtendedFileAttrs{Attr: "x"}},
+			{Path: []string{"dirlink"}, ExtendedFileAttrs: symlink("sub")},
+			{Path: []string{"link"}, ExtendedFileAttrs: symlink("a")},
+			{Path: []string{"sub", "b"}, Length: 1},
+		},
+	}
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	// Symlinks are created when the piece at their offset completes.
+	_, err = os.Lstat(filepath.Join(dir, "d", "link"))
+	assert.True(t, os.IsNotExist(err))
+	p0 := ts.Piece(info.Piece(0))
+	_, err = p0.WriteAt([]byte("he"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p0.MarkComplete())
+	fi, err := os.Stat(filepath.Join(dir, "d", "a"))
+	require.NoError(t, err)
+	assert.Zero(t, fi.Mode()&0o111)
+	// The symlinks are within this piece.
+	p1 := ts.Piece(info.Piece(1))
+	_, err = p1.WriteAt([]byte("yo"), 0)
+	require.NoError(t, err)
+	require.NoError(t, p1.MarkComplete())
+	assert.True(t, p1.Completion().Complete)
+	target, err := os.Readlink(filepath.Join(dir, "d", "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", target)
+	buf := make([]byte, 2)
+	_, err = p1.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "yo", string(buf))
+	fi, err = os.Stat(filepath.Join(dir, "d", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o100), fi.Mode()&0o100)
+	b, err := os.ReadFile(filepath.Join(dir, "d", "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "hey", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, "d", "dirlink", "b"))
+	require.NoError(t, err)
+	assert.Equal(t, "o", string(b))
+
+	// Files that were completed before opening still get their permissions and symlinks.
+	require.NoError(t, os.Chmod(filepath.Join(dir, "d", "a"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "d", "link")))
+	_, err = s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	fi, err = os.Stat(filepath.Join(dir, "d", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+	target, err = os.Readlink(filepath.Join(dir, "d", "link"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", target)
+
+	info.Files[2].SymlinkPath = []string{"..", "..", "escape"}
+	_, err = s.OpenTorrent(info, metainfo.Hash{})
+	assert.Error(t, err)
+	info.Files[2].SymlinkPath = []string{"a"}
+	info.Files[2].Length = 1
+	_, err = s.OpenTorrent(info, metainfo.Hash{})
+	assert.ErrorContains(t, err, "symlink has length")
+}
+
+// Symlinks can't be used to write outside the torrent directory.
+func TestFileSymlinkEscapes(t *testing.T) {
+	base := t.TempDir()
+	clientDir := filepath.Join(base, "x", "y")
+	s := NewFileOpts(NewFileClientOpts{
+		ClientBaseDir:   clientDir,
+		PieceCompletion: NewMapPieceCompletion(),
+	})
+	defer s.Close()
+	symlink := func(target ...string) metainfo.ExtendedFileAttrs {
+		return metainfo.ExtendedFileAttrs{Attr: "l", SymlinkPath: target}
+	}
+	open := func(files ...metainfo.FileInfo) (TorrentImpl, error) {
+		return s.OpenTorrent(&metainfo.Info{
+			Name:        "d",
+			PieceLength: 2,
+			Files:       files,
+		}, metainfo.Hash{})
+	}
+	_, err := open(
+		metainfo.FileInfo{Path: []string{"a"}, ExtendedFileAttrs: symlink("..")},
+		metainfo.FileInfo{Path: []string{"a", "c"}, ExtendedFileAttrs: symlink("..")},
+		metainfo.FileInfo{Path: []string{"a", "c", "pwned"}, Length: 2},
+	)
+	assert.Error(t, err)
+	// Links to the torrent directory.
+	_, err = open(
+		metainfo.FileInfo{Path: []string{"a"}, ExtendedFileAttrs: symlink(".")},
+		metainfo.FileInfo{Path: []string{"b"}, Length: 2},
+	)
+	assert.ErrorContains(t, err, "is not within")
+	// Data beneath a symlink of the torrent.
+	_, err = open(
+		metainfo.FileInfo{Path: []string{"a"}, ExtendedFileAttrs: symlink("sub")},
+		metainfo.FileInfo{Path: []string{"a", "pwned"}, Length: 2},
+	)
+	assert.ErrorContains(t, err, "is beneath symlink")
+
+	// A directory that's a symlink out of the torrent on disk already.
+	outside := filepath.Join(base, "outside")
+	require.NoError(t, os.Mkdir(outside, 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(clientDir, "d"), 0o755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(clientDir, "d", "out")))
+	info := &metainfo.Info{
+		Name:        "d",
+		PieceLength: 2,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"b"}, Length: 2},
+			{Path: []string{"out", "link"}, ExtendedFileAttrs: symlink("b")},
+		},
+	}
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	assert.ErrorContains(t, ts.Piece(info.Piece(0)).MarkComplete(), "resolves outside")
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	entries, err = os.ReadDir(base)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"io"
 
 	g "github.com/anacrolix/generics"
@@ -33,6 +34,20 @@ type TorrentImpl struct {
 	// to determine the storage for torrents sharing the same function pointer, and mutated in
 	// place.
 	Capacity TorrentCapacity
+	// Optional. Moves the data to newDir, which takes the place of the base directory the storage
+	// was created with. Reads and writes wait until the move completes. On error, the data remains
+	// at the old location.
+	Move func(ctx context.Context, newDir string, progress func(MoveProgress)) error
+	// Optional. Changes the paths of files, given by their index in metainfo.Info.UpvertedFiles, to
+	// what they would be if they had the new path components in the info. For a single-file torrent
+	// the components replace the name. Existing data is moved. This should tolerate being called
+	// again with the same renames after the storage is reopened.
+	RenameFiles func(renames map[int][]string) error
+	// Optional. Removes the data written for the torrent, and any directories left empty, without
+	// touching anything outside the torrent's directory. Called after Close.
+	DeleteData func() error
+	// Optional. Forgets the completion of the torrent's pieces. Called after Close.
+	DeletePieceCompletion func() error
 }
 
 // Interacts with torrent piece data. Optional interfaces to implement include:
@@ -32,3 +32,13 @@ func (me *mapPieceCompletion) Set(pk metainfo.PieceKey, b bool) error {
 	me.m.Store(pk, b)
 	return nil
 }
+
+func (me *mapPieceCompletion) DeleteTorrent(ih metainfo.Hash) error {
+	me.m.Range(func(key, _ any) bool {
+		if key.(metainfo.PieceKey).InfoHash == ih {
+			me.m.Delete(key)
+		}
+		return true
+	})
+	return nil
+}
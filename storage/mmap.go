@@ -4,11 +4,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/anacrolix/missinggo/v2"
 	"github.com/edsrzf/mmap-go"
@@ -37,11 +39,20 @@ func NewMMapWithCompletion(baseDir string, completion PieceCompletion) *mmapClie
 func (s *mmapClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (_ TorrentImpl, err error) {
 	span, err := mMapTorrent(info, s.baseDir)
 	t := &mmapTorrentStorage{
+		info:     info,
 		infoHash: infoHash,
+		baseDir:  s.baseDir,
 		span:     span,
 		pc:       s.pc,
 	}
-	return TorrentImpl{Piece: t.Piece, Close: t.Close, Flush: t.Flush}, err
+	return TorrentImpl{
+		Piece:                 t.Piece,
+		Close:                 t.Close,
+		Flush:                 t.Flush,
+		Move:                  t.Move,
+		DeleteData:            t.DeleteData,
+		DeletePieceCompletion: t.DeletePieceCompletion,
+	}, err
 }
 
 func (s *mmapClientImpl) Close() error {
@@ -49,22 +60,29 @@ func (s *mmapClientImpl) Close() error {
 }
 
 type mmapTorrentStorage struct {
+	info     *metainfo.Info
 	infoHash metainfo.Hash
-	span     *mmap_span.MMapSpan
-	pc       PieceCompletionGetSetter
+	// Guards baseDir and span, which are replaced when the torrent is moved.
+	mu      sync.RWMutex
+	baseDir string
+	span    *mmap_span.MMapSpan
+	pc      PieceCompletionGetSetter
 }
 
 func (ts *mmapTorrentStorage) Piece(p metainfo.Piece) PieceImpl {
+	_io := mmapTorrentStorageIO{ts}
 	return mmapStoragePiece{
 		pc:       ts.pc,
 		p:        p,
 		ih:       ts.infoHash,
-		ReaderAt: io.NewSectionReader(ts.span, p.Offset(), p.Length()),
-		WriterAt: missinggo.NewSectionWriter(ts.span, p.Offset(), p.Length()),
+		ReaderAt: io.NewSectionReader(_io, p.Offset(), p.Length()),
+		WriterAt: missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
 	}
 }
 
 func (ts *mmapTorrentStorage) Close() error {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
 	errs := ts.span.Close()
 	if len(errs) > 0 {
 		return errs[0]
@@ -73,6 +91,8 @@ func (ts *mmapTorrentStorage) Close() error {
 }
 
 func (ts *mmapTorrentStorage) Flush() error {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
 	errs := ts.span.Flush()
 	if len(errs) > 0 {
 		return errs[0]
@@ -80,6 +100,83 @@ func (ts *mmapTorrentStorage) Flush() error {
 	return nil
 }
 
+func (ts *mmapTorrentStorage) DeleteData() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	files, err := mmapTorrentFiles(ts.info, ts.baseDir)
+	if err != nil {
+		return err
+	}
+	return deleteFiles(files, ts.baseDir)
+}
+
+func (ts *mmapTorrentStorage) DeletePieceCompletion() error {
+	return deleteTorrentPieceCompletion(ts.pc, ts.infoHash)
+}
+
+func (ts *mmapTorrentStorage) Move(ctx context.Context, newDir string, progress func(MoveProgress)) (err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	oldDir := ts.baseDir
+	oldFiles, err := mmapTorrentFiles(ts.info, oldDir)
+	if err != nil {
+		return
+	}
+	newFiles, err := mmapTorrentFiles(ts.info, newDir)
+	if err != nil {
+		return
+	}
+	moves := make([]fileMove, 0, len(newFiles))
+	for i, f := range newFiles {
+		moves = append(moves, fileMove{
+			from:   oldFiles[i].path,
+			to:     f.path,
+			length: f.length,
+		})
+	}
+	// The files must be unmapped to be copied consistently, and on some platforms to be renamed.
+	if errs := ts.span.Flush(); len(errs) != 0 {
+		return errs[0]
+	}
+	ts.span.Close()
+	reopen := func(dir string) error {
+		span, err := mMapTorrent(ts.info, dir)
+		if err != nil {
+			return err
+		}
+		ts.span = span
+		ts.baseDir = dir
+		return nil
+	}
+	mv, err := moveFiles(ctx, moves, progress)
+	if err == nil {
+		err = reopen(newDir)
+		if err == nil {
+			mv.commitLoggingErr(oldDir)
+			return
+		}
+		err = errors.Join(err, mv.rollback())
+	}
+	return errors.Join(err, reopen(oldDir))
+}
+
+// Exposes the current span of a mmapTorrentStorage, which is replaced when the torrent is moved.
+type mmapTorrentStorageIO struct {
+	ts *mmapTorrentStorage
+}
+
+func (me mmapTorrentStorageIO) ReadAt(b []byte, off int64) (int, error) {
+	me.ts.mu.RLock()
+	defer me.ts.mu.RUnlock()
+	return me.ts.span.ReadAt(b, off)
+}
+
+func (me mmapTorrentStorageIO) WriteAt(b []byte, off int64) (int, error) {
+	me.ts.mu.RLock()
+	defer me.ts.mu.RUnlock()
+	return me.ts.span.WriteAt(b, off)
+}
+
 type mmapStoragePiece struct {
 	pc PieceCompletionGetSetter
 	p  metainfo.Piece
@@ -117,15 +214,13 @@ func mMapTorrent(md *metainfo.Info, location string) (mms *mmap_span.MMapSpan, e
 			mms.Close()
 		}
 	}()
-	for _, miFile := range md.UpvertedFiles() {
-		var safeName string
-		safeName, err = ToSafeFilePath(append([]string{md.BestName()}, miFile.BestPath()...)...)
-		if err != nil {
-			return
-		}
-		fileName := filepath.Join(location, safeName)
+	files, err := mmapTorrentFiles(md, location)
+	if err != nil {
+		return
+	}
+	for i, miFile := range md.UpvertedFiles() {
 		var mm FileMapping
-		mm, err = mmapFile(fileName, miFile.Length)
+		mm, err = mmapFile(files[i].path, miFile.Length)
 		if err != nil {
 			err = fmt.Errorf("file %q: %s", miFile.DisplayPath(md), err)
 			return
@@ -136,6 +231,21 @@ func mMapTorrent(md *metainfo.Info, location string) (mms *mmap_span.MMapSpan, e
 	return
 }
 
+func mmapTorrentFiles(md *metainfo.Info, location string) (files []file, err error) {
+	for _, miFile := range md.UpvertedFiles() {
+		var safeName string
+		safeName, err = ToSafeFilePath(append([]string{md.BestName()}, miFile.BestPath()...)...)
+		if err != nil {
+			return
+		}
+		files = append(files, file{
+			path:   filepath.Join(location, safeName),
+			length: miFile.Length,
+		})
+	}
+	return
+}
+
 func mmapFile(name string, size int64) (_ FileMapping, err error) {
 	dir := filepath.Dir(name)
 	err = os.MkdirAll(dir, 0o750)
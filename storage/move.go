@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/log"
+)
+
+// Progress of TorrentImpl.Move. Files that are renamed count entirely as soon as they're moved.
+// Copied files count as they're copied, before they're verified.
+type MoveProgress struct {
+	BytesMoved int64
+	BytesTotal int64
+}
+
+// A file to be moved from one path to another.
+type fileMove struct {
+	from   string
+	to     string
+	length int64
+}
+
+// Tracks the files that were moved, so they can be moved back or cleaned up.
+type fileMover struct {
+	progress func(MoveProgress)
+	moved    int64
+	total    int64
+	renamed  []fileMove
+	copied   []fileMove
+}
+
+// Moves files by renaming them, or by copying them if renaming fails such as across filesystems.
+// On error everything is moved back. Otherwise the caller should commit or roll back the returned
+// fileMover.
+func moveFiles(ctx context.Context, moves []fileMove, progress func(MoveProgress)) (*fileMover, error) {
+	mv := &fileMover{progress: progress}
+	for _, m := range moves {
+		mv.total += m.length
+		if m.from == m.to {
+			continue
+		}
+		// Don't clobber anything at the destination.
+		if _, err := os.Lstat(m.to); err == nil {
+			return nil, fmt.Errorf("destination %q already exists", m.to)
+		}
+	}
+	mv.report()
+	for _, m := range moves {
+		err := ctx.Err()
+		if err == nil {
+			err = mv.move(ctx, m)
+			if err != nil {
+				err = fmt.Errorf("moving %q to %q: %w", m.from, m.to, err)
+			}
+		}
+		if err != nil {
+			return nil, errors.Join(err, mv.rollback())
+		}
+	}
+	return mv, nil
+}
+
+func (mv *fileMover) report() {
+	if mv.progress != nil {
+		mv.progress(MoveProgress{
+			BytesMoved: mv.moved,
+			BytesTotal: mv.total,
+		})
+	}
+}
+
+func (mv *fileMover) move(ctx context.Context, m fileMove) error {
+	if m.from == m.to {
+		mv.moved += m.length
+		mv.report()
+		return nil
+	}
+	if _, err := os.Lstat(m.from); errors.Is(err, os.ErrNotExist) {
+		// Nothing has been written to this file yet.
+		mv.moved += m.length
+		mv.report()
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(m.to), 0o777)
+	if err != nil {
+		return err
+	}
+	if os.Rename(m.from, m.to) == nil {
+		mv.renamed = append(mv.renamed, m)
+		mv.moved += m.length
+		mv.report()
+		return nil
+	}
+	// The destination is probably on another filesystem.
+	err = mv.copyFile(ctx, m)
+	if err != nil {
+		os.Remove(m.to)
+		return err
+	}
+	mv.copied = append(mv.copied, m)
+	return nil
+}
+
+// Copies the file, and then checks the copy matches the original.
+func (mv *fileMover) copyFile(ctx context.Context, m fileMove) (err error) {
+	src, err := os.Open(m.from)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return
+	}
+	dst, err := os.OpenFile(m.to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := dst.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	buf := make([]byte, 1<<20)
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		n, readErr := src.Read(buf)
+		if n != 0 {
+			_, err = dst.Write(buf[:n])
+			if err != nil {
+				return
+			}
+			mv.moved += int64(n)
+			mv.report()
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	err = dst.Sync()
+	if err != nil {
+		return
+	}
+	return verifyFileCopy(m.from, m.to)
+}
+
+func verifyFileCopy(from, to string) error {
+	a, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(to)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	bufA := make([]byte, 1<<20)
+	bufB := make([]byte, len(bufA))
+	for {
+		nA, errA := io.ReadFull(a, bufA)
+		nB, errB := io.ReadFull(b, bufB)
+		if nA != nB || !bytes.Equal(bufA[:nA], bufB[:nB]) {
+			return errors.New("copy doesn't match original")
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			if errB != errA {
+				return errors.New("copy doesn't match original")
+			}
+			return nil
+		}
+		if errA != nil {
+			return errA
+		}
+		if errB != nil {
+			return errB
+		}
+	}
+}
+
+// Moves renamed files back, and removes copies.
+func (mv *fileMover) rollback() error {
+	var errs []error
+	for i := len(mv.renamed) - 1; i >= 0; i-- {
+		m := mv.renamed[i]
+		errs = append(errs, os.Rename(m.to, m.from))
+	}
+	for _, m := range mv.copied {
+		errs = append(errs, os.Remove(m.to))
+	}
+	mv.renamed = nil
+	mv.copied = nil
+	return errors.Join(errs...)
+}
+
+// Removes the originals of copied files, and any directories left empty beneath oldDir.
+func (mv *fileMover) commit(oldDir string) error {
+	var errs []error
+	for _, m := range mv.copied {
+		errs = append(errs, os.Remove(m.from))
+	}
+	for _, m := range append(mv.renamed, mv.copied...) {
+		removeEmptyDirs(filepath.Dir(m.from), oldDir)
+	}
+	return errors.Join(errs...)
+}
+
+// Commits the move, logging originals that couldn't be removed. The data is already in its new
+// home, so they're left behind rather than failing the move.
+func (mv *fileMover) commitLoggingErr(oldDir string) {
+	err := mv.commit(oldDir)
+	if err != nil {
+		log.Levelf(log.Warning, "error removing originals of moved files: %v", err)
+	}
+}
+
+// Removes dir and its parents while they're empty, stopping at stop, which isn't removed.
+func removeEmptyDirs(dir, stop string) {
+	stop = filepath.Clean(stop)
+	for dir != stop && isSubFilepath(stop, dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func testMoveTorrent(t *testing.T, newClient func(dir string) ClientImplCloser) {
+	c := qt.New(t)
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	s := newClient(oldDir)
+	defer s.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		PieceLength: 4,
+		Files: []metainfo.FileInfo{
+			{Path: []string{"b", "c"}, Length: 3},
+			{Path: []string{"d"}, Length: 5},
+		},
+	}
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	c.Assert(err, qt.IsNil)
+	defer ts.Close()
+	p := ts.Piece(info.Piece(0))
+	_, err = p.WriteAt([]byte("hell"), 0)
+	c.Assert(err, qt.IsNil)
+
+	var progress []MoveProgress
+	err = ts.Move(context.Background(), newDir, func(p MoveProgress) {
+		progress = append(progress, p)
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(progress[len(progress)-1], qt.Equals, MoveProgress{BytesMoved: 8, BytesTotal: 8})
+	b, err := os.ReadFile(filepath.Join(newDir, "a", "b", "c"))
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "hel")
+	_, err = os.Stat(filepath.Join(oldDir, "a"))
+	c.Check(os.IsNotExist(err), qt.IsTrue)
+
+	// The storage continues at the new location.
+	_, err = ts.Piece(info.Piece(1)).WriteAt([]byte("o, w"), 0)
+	c.Assert(err, qt.IsNil)
+	b, err = os.ReadFile(filepath.Join(newDir, "a", "d"))
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "lo, w")
+	buf := make([]byte, 4)
+	_, err = p.ReadAt(buf, 0)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(buf), qt.Equals, "hell")
+
+	// Moving onto existing files fails, and leaves the data where it was.
+	clobberDir := t.TempDir()
+	c.Assert(os.MkdirAll(filepath.Join(clobberDir, "a"), 0o777), qt.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(clobberDir, "a", "d"), nil, 0o666), qt.IsNil)
+	err = ts.Move(context.Background(), clobberDir, nil)
+	c.Check(err, qt.ErrorMatches, `destination .* already exists`)
+	_, err = p.ReadAt(buf, 0)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(buf), qt.Equals, "hell")
+
+	// Cancelled moves are rolled back.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = ts.Move(ctx, t.TempDir(), nil)
+	c.Check(err, qt.ErrorIs, context.Canceled)
+	_, err = os.Stat(filepath.Join(newDir, "a", "b", "c"))
+	c.Check(err, qt.IsNil)
+}
+
+func TestFileMove(t *testing.T) {
+	testMoveTorrent(t, func(dir string) ClientImplCloser {
+		return NewFileOpts(NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: NewMapPieceCompletion(),
+		})
+	})
+}
+
+func TestMMapMove(t *testing.T) {
+	testMoveTorrent(t, func(dir string) ClientImplCloser {
+		return NewMMapWithCompletion(dir, NewMapPieceCompletion())
+	})
+}
+
+func TestMoveCopyVerifies(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from")
+	c.Assert(os.WriteFile(from, []byte("hello"), 0o640), qt.IsNil)
+	m := fileMove{from: from, to: filepath.Join(dir, "to"), length: 5}
+	mv := fileMover{total: 5}
+	c.Assert(mv.copyFile(context.Background(), m), qt.IsNil)
+	c.Check(mv.moved, qt.Equals, int64(5))
+	b, err := os.ReadFile(m.to)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "hello")
+	c.Assert(os.WriteFile(m.to, []byte("hellO"), 0o640), qt.IsNil)
+	c.Check(verifyFileCopy(m.from, m.to), qt.IsNotNil)
+	mv.copied = append(mv.copied, m)
+	c.Assert(mv.commit(dir), qt.IsNil)
+	_, err = os.Stat(from)
+	c.Check(os.IsNotExist(err), qt.IsTrue)
+}
@@ -72,6 +72,15 @@ func (me *sqlitePieceCompletion) Set(pk metainfo.PieceKey, b bool) error {
 		pk.InfoHash.HexString(), pk.Index, b)
 }
 
+func (me *sqlitePieceCompletion) DeleteTorrent(ih metainfo.Hash) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.closed {
+		return errors.New("closed")
+	}
+	return sqlitex.Exec(me.db, `delete from piece_completion where infohash=?`, nil, ih.HexString())
+}
+
 func (me *sqlitePieceCompletion) Close() (err error) {
 	me.mu.Lock()
 	defer me.mu.Unlock()
@@ -0,0 +1,61 @@
+package torrent
+
+import (
+	"slices"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+const (
+	// The number of a peer's most recent suggestions that we prefer when requesting from them.
+	maxPeerSuggestedPieces = 16
+	// The number of pieces most recently read from storage for peers, that we suggest to others.
+	maxRecentlyReadPieces = 8
+)
+
+// Handles a BEP 6 Suggest from the peer. Suggested pieces are preferred when requesting from the
+// peer, after priority, deadlines and sequential order.
+func (cn *Peer) onPeerSuggested(i pieceIndex) {
+	if !cn.t.haveInfo() || i < 0 || i >= cn.t.numPieces() {
+		return
+	}
+	cn.peerSuggestedPieces = slices.DeleteFunc(cn.peerSuggestedPieces, func(j pieceIndex) bool {
+		return j == i
+	})
+	if len(cn.peerSuggestedPieces) >= maxPeerSuggestedPieces {
+		cn.peerSuggestedPieces = slices.Delete(cn.peerSuggestedPieces, 0, 1)
+	}
+	cn.peerSuggestedPieces = append(cn.peerSuggestedPieces, i)
+	cn.updateRequests("suggested")
+}
+
+func (cn *Peer) peerSuggested(i pieceIndex) bool {
+	return slices.Contains(cn.peerSuggestedPieces, i)
+}
+
+// Called when a piece has been read from storage to serve a peer. The piece is likely cached now,
+// so we suggest it to other peers that might want it.
+func (t *Torrent) onPieceReadForPeer(i pieceIndex, reader *PeerConn) {
+	if t.superSeedingActive() || slices.Contains(t.recentlyReadPieces, i) {
+		return
+	}
+	if len(t.recentlyReadPieces) >= maxRecentlyReadPieces {
+		t.recentlyReadPieces = slices.Delete(t.recentlyReadPieces, 0, 1)
+	}
+	t.recentlyReadPieces = append(t.recentlyReadPieces, i)
+	for c := range t.conns {
+		if c == reader || !c.fastEnabled() || !c.peerInterested || c.peerHasPiece(i) {
+			continue
+		}
+		// The peer must know we have it, and only needs telling once.
+		if !c.sentHaves.Get(bitmap.BitIndex(i)) || !c.sentSuggestions.CheckedAdd(i) {
+			continue
+		}
+		c.write(pp.Message{
+			Type:  pp.Suggest,
+			Index: pp.Integer(i),
+		})
+	}
+}
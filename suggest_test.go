@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	requestStrategy "github.com/anacrolix/torrent/request-strategy"
+)
+
+func newSuggestTestTorrent(c *qt.C) (*Client, *Torrent) {
+	cl := newTestingClient(c)
+	tt := cl.newTorrentForTesting()
+	c.Assert(tt.setInfo(&metainfo.Info{
+		PieceLength: 1,
+		Length:      3,
+		Pieces:      make([]byte, pieceHash.Size()*3),
+	}), qt.IsNil)
+	tt.onSetInfo()
+	return cl, tt
+}
+
+func TestPeerSuggestedPiecesPreferred(t *testing.T) {
+	c := qt.New(t)
+	cl, tt := newSuggestTestTorrent(c)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.setTorrent(tt)
+	cl.lock()
+	defer cl.unlock()
+	tt.pieceRequestOrder = []int{0, 1, 2}
+	p := desiredPeerRequests{
+		peer:        &pc.Peer,
+		pieceStates: make([]requestStrategy.PieceRequestOrderState, 3),
+	}
+	// Each piece is a single chunk.
+	c.Check(p.lessByValue(0, 1), qt.IsTrue)
+	pc.onPeerSuggested(1)
+	pc.onPeerSuggested(5)
+	c.Check(pc.peerSuggestedPieces, qt.DeepEquals, []pieceIndex{1})
+	c.Check(p.lessByValue(1, 0), qt.IsTrue)
+	c.Check(p.lessByValue(0, 1), qt.IsFalse)
+}
+
+func TestSuggestRecentlyReadPieces(t *testing.T) {
+	c := qt.New(t)
+	cl, tt := newSuggestTestTorrent(c)
+	tt._completedPieces.AddRange(0, 3)
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+		pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+		pc.setTorrent(tt)
+		pc.initMessageWriter()
+		pc.peerInterested = true
+		pc.sentHaves.AddRange(0, 3)
+		tt.conns[pc] = struct{}{}
+		return pc
+	}
+	cl.lock()
+	defer cl.unlock()
+	reader := newConn()
+	other := newConn()
+	seed := newConn()
+	seed.peerSentHaveAll = true
+	tt.onPieceReadForPeer(2, reader)
+	c.Check(tt.recentlyReadPieces, qt.DeepEquals, []pieceIndex{2})
+	c.Check(other.sentSuggestions.Contains(2), qt.IsTrue)
+	c.Check(reader.sentSuggestions.IsEmpty(), qt.IsTrue)
+	c.Check(seed.sentSuggestions.IsEmpty(), qt.IsTrue)
+}
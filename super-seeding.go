@@ -0,0 +1,112 @@
+package torrent
+
+import (
+	"github.com/anacrolix/log"
+	"github.com/anacrolix/missinggo/v2/bitmap"
+)
+
+// Enables or disables BEP 16 super-seeding. While the Torrent has all its pieces, new connections
+// are told about one piece at a time, and a peer is only told about another once the piece it was
+// given has been seen at another peer. Super-seeding turns off once the connected peers have every
+// piece between them, and then peers are told about the pieces they weren't shown.
+func (t *Torrent) SetSuperSeeding(on bool) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if on == t.superSeeding {
+		return
+	}
+	if on {
+		t.superSeeding = true
+	} else {
+		t.stopSuperSeeding()
+	}
+}
+
+func (t *Torrent) SuperSeeding() bool {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.superSeeding
+}
+
+// Super-seeding only applies while we're a seed.
+func (t *Torrent) superSeedingActive() bool {
+	return t.superSeeding && t.haveAllPieces()
+}
+
+func (t *Torrent) stopSuperSeeding() {
+	t.superSeeding = false
+	for c := range t.conns {
+		c.superSeedPiece.SetNone()
+		t._completedPieces.Iterate(func(x uint32) bool {
+			c.have(pieceIndex(x))
+			return true
+		})
+	}
+}
+
+// Reveals the piece that will most help the swarm, if the peer doesn't already have everything.
+// Rare pieces are preferred, and then those revealed to the fewest other peers.
+func (t *Torrent) superSeedOffer(c *PeerConn) {
+	offers := make(map[pieceIndex]int)
+	for other := range t.conns {
+		if other.superSeedPiece.Ok {
+			offers[other.superSeedPiece.Value]++
+		}
+	}
+	best := -1
+	for i := range t.numPieces() {
+		if c.peerHasPiece(i) || c.sentHaves.Get(bitmap.BitIndex(i)) {
+			continue
+		}
+		if best != -1 {
+			availability, bestAvailability := t.piece(i).availability(), t.piece(best).availability()
+			if availability > bestAvailability ||
+				availability == bestAvailability && offers[i] >= offers[best] {
+				continue
+			}
+		}
+		best = i
+	}
+	if best == -1 {
+		c.superSeedPiece.SetNone()
+		return
+	}
+	c.superSeedPiece.Set(best)
+	c.have(best)
+}
+
+// A peer having a piece that was revealed to another peer means it's propagating, so the other
+// peer can be given another.
+func (t *Torrent) superSeedOnPeerHave(from *PeerConn, piece pieceIndex) {
+	if !t.superSeedingActive() {
+		return
+	}
+	for c := range t.conns {
+		if c != from && c.superSeedPiece.Ok && c.superSeedPiece.Value == piece {
+			t.superSeedOffer(c)
+		}
+	}
+	t.maybeStopSuperSeeding()
+}
+
+// A peer that announced it already has the piece revealed to it needs another.
+func (t *Torrent) superSeedOnPeerBitfield(c *PeerConn) {
+	if !t.superSeedingActive() {
+		return
+	}
+	if !c.superSeedPiece.Ok || c.peerHasPiece(c.superSeedPiece.Value) {
+		t.superSeedOffer(c)
+	}
+	t.maybeStopSuperSeeding()
+}
+
+// Stops super-seeding once the connected peers have a full copy between them.
+func (t *Torrent) maybeStopSuperSeeding() {
+	for i := range t.numPieces() {
+		if t.piece(i).availability() == 0 {
+			return
+		}
+	}
+	t.logger.Levelf(log.Info, "peers have a distributed copy, stopping super-seeding")
+	t.stopSuperSeeding()
+}
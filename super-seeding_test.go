@@ -0,0 +1,64 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestSuperSeeding(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrentForTesting()
+	c.Assert(tt.setInfo(&metainfo.Info{
+		PieceLength: 1,
+		Length:      3,
+		Pieces:      make([]byte, pieceHash.Size()*3),
+	}), qt.IsNil)
+	tt.onSetInfo()
+	tt._completedPieces.AddRange(0, 3)
+	tt.SetSuperSeeding(true)
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+		pc.setTorrent(tt)
+		// Messages are buffered, but never written.
+		pc.initMessageWriter()
+		tt.conns[pc] = struct{}{}
+		return pc
+	}
+	cl.lock()
+	defer cl.unlock()
+	c.Assert(tt.superSeedingActive(), qt.IsTrue)
+	a := newConn()
+	tt.superSeedOffer(a)
+	b := newConn()
+	tt.superSeedOffer(b)
+	c.Assert(a.superSeedPiece.Ok, qt.IsTrue)
+	c.Assert(b.superSeedPiece.Ok, qt.IsTrue)
+	first := a.superSeedPiece.Value
+	c.Check(b.superSeedPiece.Value, qt.Not(qt.Equals), first)
+	c.Check(int(a.sentHaves.Len()), qt.Equals, 1)
+
+	// A peer getting the piece it was given doesn't earn it another.
+	c.Assert(a.peerSentHave(first), qt.IsNil)
+	c.Check(a.superSeedPiece.Value, qt.Equals, first)
+	// The piece reaching another peer does.
+	c.Assert(b.peerSentHave(first), qt.IsNil)
+	c.Check(a.superSeedPiece.Value, qt.Not(qt.Equals), first)
+	c.Check(int(a.sentHaves.Len()), qt.Equals, 2)
+	c.Check(tt.superSeeding, qt.IsTrue)
+
+	// Once the peers have every piece between them, super-seeding stops, and everything is revealed.
+	for i := range tt.numPieces() {
+		if !b.peerHasPiece(i) {
+			c.Assert(b.peerSentHave(i), qt.IsNil)
+		}
+	}
+	c.Check(tt.superSeeding, qt.IsFalse)
+	c.Check(int(a.sentHaves.Len()), qt.Equals, 3)
+	c.Check(a.sentHaves.Get(bitmap.BitIndex(first)), qt.IsTrue)
+}
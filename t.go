@@ -224,6 +224,7 @@ func (t *Torrent) initFiles() {
 			fi.DisplayPath(info),
 			PiecePriorityNone,
 			fi.PiecesRoot,
+			false,
 		})
 		offset += fi.Length
 		if info.FilesArePieceAligned() {
@@ -14,4 +14,8 @@ type TorrentStats struct {
 	ConnectedSeeders int
 	HalfOpenPeers    int
 	PiecesComplete   int
+	// Whether the Torrent is paused. See Torrent.Pause.
+	Paused bool
+	// Whether the Torrent is waiting in the Client's queue. See Torrent.Queued.
+	Queued bool
 }
@@ -14,6 +14,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 	"unsafe"
@@ -34,6 +35,7 @@ import (
 	"github.com/pion/datachannel"
 	"golang.org/x/exp/maps"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/internal/check"
@@ -66,6 +68,45 @@ type Torrent struct {
 	dataUploadDisallowed   bool
 	userOnWriteChunkErr    func(error)
 
+	// Set by Pause. Networking is disabled while this is true.
+	paused bool
+	// Waiting in the Client's queue for an active slot. Networking is disabled while this is true.
+	queued bool
+	// When the Torrent last got an active slot in the queue.
+	queueActiveSince time.Time
+	// When useful data was last received from any peer.
+	lastUsefulData time.Time
+
+	// Overrides ClientConfig.SeedLimits.
+	seedLimits       g.Option[SeedLimits]
+	seedLimitReached bool
+	// Time spent actively seeding, and the part of that since data was last uploaded.
+	seedTime               time.Duration
+	seedIdleTime           time.Duration
+	seedLimitsLastUploaded int64
+
+	// Limits specific to this Torrent, and shared with other Torrents. These stack with the Client's.
+	uploadRateLimiter   *rate.Limiter
+	downloadRateLimiter *rate.Limiter
+	bandwidthGroup      atomic.Pointer[BandwidthGroup]
+
+	// Whether all pieces are requested in index order, and how many at once. See also File.sequential.
+	sequential          bool
+	sequentialWindow    int
+	sequentialWindowEnd pieceIndex
+
+	pieceDeadlines map[pieceIndex]pieceDeadline
+	deadlineTimer  *time.Timer
+	// Requests made to peers in addition to the one in requestState, for late pieces.
+	duplicateRequests map[RequestIndex][]requestState
+
+	// BEP 16. See Torrent.SetSuperSeeding.
+	superSeeding bool
+	// Pieces recently read from storage for peers, oldest first. They're suggested to other peers.
+	recentlyReadPieces []pieceIndex
+	// Hash trees for files built from their piece layers, for answering hash requests.
+	fileHashTrees map[*File][][][32]byte
+
 	closed  chansync.SetOnce
 	onClose []func()
 
@@ -92,6 +133,9 @@ type Torrent struct {
 	storage *storage.Torrent
 	// Read-locked for using storage, and write-locked for Closing.
 	storageLock sync.RWMutex
+	// Set while MoveStorage is running. Guarded by storageMoveMu rather than the Client lock.
+	storageMoveMu sync.Mutex
+	storageMove   g.Option[storage.MoveProgress]
 
 	// TODO: Only announce stuff is used?
 	metainfo metainfo.MetaInfo
@@ -124,9 +168,11 @@ type Torrent struct {
 	numDHTAnnounces int
 
 	// Name used if the info name isn't available. Should be cleared when the
-	// Info does become available.
+	// Info does become available. nameMu also guards the paths of renamed Files.
 	nameMu      sync.RWMutex
 	displayName string
+	// Held across RenameFiles, so renames are checked against the paths they'll replace.
+	renameMu sync.Mutex
 
 	// The bencoded bytes of the info dict. This is actively manipulated if
 	// the info bytes aren't initially available, and we try to fetch them
@@ -153,6 +199,13 @@ type Torrent struct {
 	piecesQueuedForHash       bitmap.Bitmap
 	activePieceHashes         int
 	initialPieceCheckDisabled bool
+	// Resume data waiting for the info to be applied.
+	resumeData *ResumeData
+	// Pieces the resume data says are complete, that haven't been marked complete in storage or
+	// hashed yet.
+	resumedPieces roaring.Bitmap
+	// BEP 53 file selection waiting for the info to be applied.
+	selectOnly []metainfo.FileIndexRange
 
 	connsWithAllPieces map[*Peer]struct{}
 
@@ -232,7 +285,7 @@ func (t *Torrent) readerReadaheadPieces() bitmap.Bitmap {
 }
 
 func (t *Torrent) ignorePieceForRequests(i pieceIndex) bool {
-	return !t.wantPieceIndex(i)
+	return !t.wantPieceIndex(i) || t.pieceOutsideSequentialWindow(i)
 }
 
 // Returns a channel that is closed when the Torrent is closed.
@@ -294,6 +347,9 @@ func (t *Torrent) pieceCompleteUncached(piece pieceIndex) storage.Completion {
 	if t.storage == nil {
 		return storage.Completion{Complete: false, Ok: true}
 	}
+	if t.resumedPieces.Contains(uint32(piece)) {
+		return storage.Completion{Complete: true, Ok: true}
+	}
 	return t.pieces[piece].Storage().Completion()
 }
 
@@ -533,9 +589,13 @@ func (t *Torrent) pieceRequestOrderKey(i int) request_strategy.PieceRequestOrder
 
 // This seems to be all the follow-up tasks after info is set, that can't fail.
 func (t *Torrent) onSetInfo() {
+	t.cl.publishEvent(MetadataReceivedEvent{t})
 	t.pieceRequestOrder = rand.Perm(t.numPieces())
 	t.initPieceRequestOrder()
 	MakeSliceWithLength(&t.requestPieceStates, t.numPieces())
+	// Resume data file priorities take precedence over the selection.
+	t.applySelectOnly()
+	t.applyResumeDataPieces()
 	for i := range t.pieces {
 		p := &t.pieces[i]
 		// Need to add relativeAvailability before updating piece completion, as that may result in conns
@@ -548,7 +608,11 @@ func (t *Torrent) onSetInfo() {
 		t.updatePieceCompletion(i)
 		t.queueInitialPieceCheck(i)
 	}
+	if !t.resumedPieces.IsEmpty() {
+		go t.markResumedPiecesComplete()
+	}
 	t.cl.event.Broadcast()
+	t.cl.queueChanged()
 	close(t.gotMetainfoC)
 	t.updateWantPeersEvent()
 	t.requestState = make(map[RequestIndex]requestState)
@@ -557,6 +621,7 @@ func (t *Torrent) onSetInfo() {
 		p.onGotInfo(t.info)
 		p.updateRequests("onSetInfo")
 	})
+	t.updateUploadOnly()
 }
 
 // Checks the info bytes hash to expected values. Fills in any missing infohashes.
@@ -801,6 +866,31 @@ func (t *Torrent) writeStatus(w io.Writer) {
 	if t.infoHashV2.Ok {
 		fmt.Fprintf(w, "Infohash v2: %s\n", t.infoHashV2.Value.HexString())
 	}
+	if t.paused {
+		fmt.Fprintln(w, "Paused")
+	}
+	if t.queued {
+		fmt.Fprintln(w, "Queued")
+	}
+	if move := t.StorageMoveProgress(); move.Ok {
+		fmt.Fprintf(w, "Moving storage: %v/%v bytes\n", move.Value.BytesMoved, move.Value.BytesTotal)
+	}
+	if len(t.pieceDeadlines) != 0 {
+		fmt.Fprintf(w, "Piece deadlines: %v (missed: %v)\n", len(t.pieceDeadlines), t.numMissedPieceDeadlines())
+	}
+	if t.sequential {
+		fmt.Fprintf(w, "Sequential (window: %v, end: %v)\n", t.sequentialWindow, t.sequentialWindowEnd)
+	}
+	if t.uploadRateLimiter.Limit() != rate.Inf {
+		fmt.Fprintf(w, "Upload rate limit: %s\n", rateLimitString(t.uploadRateLimiter))
+	}
+	if t.downloadRateLimiter.Limit() != rate.Inf {
+		fmt.Fprintf(w, "Download rate limit: %s\n", rateLimitString(t.downloadRateLimiter))
+	}
+	if bg := t.bandwidthGroup.Load(); bg != nil {
+		fmt.Fprintf(w, "Bandwidth group: %q (upload %s, download %s)\n",
+			bg.name, rateLimitString(bg.uploadLimiter), rateLimitString(bg.downloadLimiter))
+	}
 	fmt.Fprintf(w, "Metadata length: %d\n", t.metadataSize())
 	if !t.haveInfo() {
 		fmt.Fprintf(w, "Metadata have: ")
@@ -1013,6 +1103,9 @@ func (t *Torrent) close(wg *sync.WaitGroup) (err error) {
 	for _, f := range t.onClose {
 		f()
 	}
+	if t.deadlineTimer != nil {
+		t.deadlineTimer.Stop()
+	}
 	if t.storage != nil {
 		wg.Add(1)
 		go func() {
@@ -1223,7 +1316,8 @@ func (t *Torrent) maybeDropMutuallyCompletePeer(
 	if !t.haveAllPieces() {
 		return
 	}
-	if all, known := p.peerHasAllPieces(); !(known && all) {
+	// Partial seeds (BEP 21) are as complete as they want to be.
+	if all, known := p.peerHasAllPieces(); !(known && all) && !p.peerUploadOnly {
 		return
 	}
 	if p.useful() {
@@ -1347,6 +1441,7 @@ func (t *Torrent) pieceAllDirty(piece pieceIndex) bool {
 func (t *Torrent) readersChanged() {
 	t.updateReaderPieces()
 	t.updateAllPiecePriorities("Torrent.readersChanged")
+	t.updateUploadOnly()
 }
 
 func (t *Torrent) updateReaderPieces() {
@@ -1384,6 +1479,7 @@ func (t *Torrent) maybeNewConns() {
 }
 
 func (t *Torrent) onPiecePendingTriggers(piece pieceIndex, reason string) {
+	t.updateUploadOnly()
 	if t._pendingPieces.Contains(uint32(piece)) {
 		t.iterPeers(func(c *Peer) {
 			// if c.requestState.Interested {
@@ -1403,6 +1499,7 @@ func (t *Torrent) onPiecePendingTriggers(piece pieceIndex, reason string) {
 	}
 	t.maybeNewConns()
 	t.publishPieceStateChange(piece)
+	t.cl.queueChanged()
 }
 
 func (t *Torrent) updatePiecePriorityNoTriggers(piece pieceIndex) (pendingChanged bool) {
@@ -1422,10 +1519,14 @@ func (t *Torrent) updatePiecePriorityNoTriggers(piece pieceIndex) (pendingChange
 }
 
 func (t *Torrent) updatePiecePriority(piece pieceIndex, reason string) {
-	if t.updatePiecePriorityNoTriggers(piece) && !t.disableTriggers {
+	pendingChanged := t.updatePiecePriorityNoTriggers(piece)
+	if pendingChanged && !t.disableTriggers {
 		t.onPiecePendingTriggers(piece, reason)
 	}
 	t.updatePieceRequestOrderPiece(piece)
+	if pendingChanged && t.sequentialWindow > 0 {
+		t.updateSequentialWindow(reason)
+	}
 }
 
 func (t *Torrent) updateAllPiecePriorities(reason string) {
@@ -1570,6 +1671,13 @@ func (t *Torrent) updatePieceCompletion(piece pieceIndex) bool {
 		t._completedPieces.Remove(x)
 	}
 	p.t.updatePieceRequestOrderPiece(piece)
+	if complete && changed {
+		for _, f := range p.files {
+			if t.fileComplete(f) {
+				t.cl.publishEvent(FileCompletedEvent{f})
+			}
+		}
+	}
 	t.updateComplete()
 	if complete && len(p.dirtiers) != 0 {
 		t.logger.Printf("marked piece %v complete but still has dirtiers", piece)
@@ -1701,6 +1809,10 @@ func (t *Torrent) deletePeerConn(c *PeerConn) (ret bool) {
 	}
 	_, ret = t.conns[c]
 	delete(t.conns, c)
+	if ret && c.unchokedByChoker {
+		// Free up the upload slot.
+		t.cl.chokeSoon()
+	}
 	// Avoid adding a drop event more than once. Probably we should track whether we've generated
 	// the drop event against the PexConnState instead.
 	if ret {
@@ -1964,6 +2076,9 @@ func (t *Torrent) announceRequest(
 ) tracker.AnnounceRequest {
 	// Note that IPAddress is not set. It's set for UDP inside the tracker code, since it's
 	// dependent on the network in use.
+	if event == tracker.None && t.partialSeed() {
+		event = tracker.Paused
+	}
 	return tracker.AnnounceRequest{
 		Event: event,
 		NumWant: func() int32 {
@@ -2149,6 +2264,8 @@ func (t *Torrent) statsLocked() (ret TorrentStats) {
 	}
 	ret.ConnStats = t.stats.Copy()
 	ret.PiecesComplete = t.numPiecesCompleted()
+	ret.Paused = t.paused
+	ret.Queued = t.queued
 	return
 }
 
@@ -2199,6 +2316,9 @@ func (t *Torrent) addPeerConn(c *PeerConn) (err error) {
 	if t.closed.IsSet() {
 		return errors.New("torrent closed")
 	}
+	if !t.networkingEnabled.Bool() {
+		return errors.New("torrent networking disabled")
+	}
 	for c0 := range t.conns {
 		if c.PeerID != c0.PeerID {
 			continue
@@ -2319,10 +2439,24 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 	})
 	p := t.piece(piece)
 	p.numVerifies++
+	// The check supersedes the resume data.
+	t.resumedPieces.Remove(uint32(piece))
 	t.cl.event.Broadcast()
 	if t.closed.IsSet() {
 		return
 	}
+	if t.cl.wantEvents() {
+		ev := PieceHashedEvent{
+			Torrent: t,
+			Piece:   piece,
+			Passed:  passed,
+			Err:     hashIoErr,
+		}
+		for c := range p.dirtiers {
+			ev.Peers = append(ev.Peers, c.RemoteAddr)
+		}
+		t.cl.publishEvent(ev)
+	}
 
 	// Don't score the first time a piece is hashed, it could be an initial check.
 	if p.storageCompletionOk {
@@ -2341,6 +2475,8 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 	defer func() {
 		p.marking = false
 		t.publishPieceStateChange(piece)
+		// The completion is settled now, for anything waiting on the check like a Verification.
+		t.cl.event.Broadcast()
 	}()
 
 	if passed {
@@ -2362,6 +2498,9 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 			t.logger.Levelf(log.Warning, "%T: error marking piece complete %d: %s", t.storage, piece, err)
 		}
 		t.cl.lock()
+		if err != nil {
+			t.cl.publishEvent(StorageErrorEvent{t, err})
+		}
 
 		if t.closed.IsSet() {
 			return
@@ -2430,6 +2569,7 @@ func (t *Torrent) cancelRequestsForPiece(piece pieceIndex) {
 }
 
 func (t *Torrent) onPieceCompleted(piece pieceIndex) {
+	t.onPieceDeadlineCompleted(piece)
 	t.pendAllChunkSpecs(piece)
 	t.cancelRequestsForPiece(piece)
 	t.piece(piece).readerCond.Broadcast()
@@ -2441,6 +2581,9 @@ func (t *Torrent) onPieceCompleted(piece pieceIndex) {
 
 // Called when a piece is found to be not complete.
 func (t *Torrent) onIncompletePiece(piece pieceIndex) {
+	for c := range t.conns {
+		c.dontHave(piece)
+	}
 	if t.pieceAllDirty(piece) {
 		t.pendAllChunkSpecs(piece)
 	}
@@ -2576,6 +2719,9 @@ func (t *Torrent) peersAsSlice() (ret []*Peer) {
 func (t *Torrent) queueInitialPieceCheck(i pieceIndex) {
 	if !t.initialPieceCheckDisabled && !t.piece(i).storageCompletionOk {
 		t.queuePieceCheck(i)
+	} else if !t.pieceComplete(i) && t.pieceAllDirty(i) {
+		// All the chunks were written before, such as with resume data, but it was never hashed.
+		t.queuePieceCheck(i)
 	}
 }
 
@@ -2702,6 +2848,7 @@ func (t *Torrent) piece(i int) *Piece {
 }
 
 func (t *Torrent) onWriteChunkErr(err error) {
+	t.cl.publishEvent(StorageErrorEvent{t, err})
 	if t.userOnWriteChunkErr != nil {
 		go t.userOnWriteChunkErr(err)
 		return
@@ -2748,6 +2895,10 @@ func (t *Torrent) AllowDataUpload() {
 func (t *Torrent) DisallowDataUpload() {
 	t.cl.lock()
 	defer t.cl.unlock()
+	t.disallowDataUpload()
+}
+
+func (t *Torrent) disallowDataUpload() {
 	t.dataUploadDisallowed = true
 	for c := range t.conns {
 		// TODO: This doesn't look right. Shouldn't we tickle writers to choke peers or something instead?
@@ -2825,10 +2976,10 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
 			HttpClient: t.cl.httpClient,
 			Url:        url,
 			ResponseBodyWrapper: func(r io.Reader) io.Reader {
-				return &rateLimitedReader{
+				return t.downloadRateLimitedReader(&rateLimitedReader{
 					l: t.cl.config.DownloadRateLimiter,
 					r: r,
-				}
+				})
 			},
 		},
 		activeRequests: make(map[Request]webseed.Request, maxRequests),
@@ -2879,13 +3030,31 @@ func (t *Torrent) pieceRequestIndexOffset(piece pieceIndex) RequestIndex {
 }
 
 func (t *Torrent) updateComplete() {
-	t.Complete.SetBool(t.haveAllPieces())
+	complete := t.haveAllPieces()
+	if complete && !t.Complete.Bool() {
+		t.cl.publishEvent(TorrentCompletedEvent{t})
+	}
+	t.Complete.SetBool(complete)
+}
+
+// Whether all the pieces of the file are complete.
+func (t *Torrent) fileComplete(f *File) bool {
+	begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+	if begin == end {
+		return true
+	}
+	n := t._completedPieces.Rank(uint32(end - 1))
+	if begin != 0 {
+		n -= t._completedPieces.Rank(uint32(begin - 1))
+	}
+	return n == uint64(end-begin)
 }
 
 func (t *Torrent) cancelRequest(r RequestIndex) *Peer {
 	p := t.requestingPeer(r)
-	if p != nil {
-		p.cancel(r)
+	// Cancelling promotes any duplicate requests, so keep going until they're all gone.
+	for q := p; q != nil; q = t.requestingPeer(r) {
+		q.cancel(r)
 	}
 	// TODO: This is a check that an old invariant holds. It can be removed after some testing.
 	//delete(t.pendingRequests, r)
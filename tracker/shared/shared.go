@@ -7,4 +7,5 @@ const (
 	Completed                   // The local peer just completed the torrent.
 	Started                     // The local peer has just resumed this torrent.
 	Stopped                     // The local peer is leaving the swarm.
+	Paused                      // The local peer is a partial seed (BEP 21).
 )
@@ -22,6 +22,7 @@ const (
 	Started   = shared.Started
 	Stopped   = shared.Stopped
 	Completed = shared.Completed
+	Paused    = shared.Paused
 )
 
 type AnnounceRequest = udp.AnnounceRequest
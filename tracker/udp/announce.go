@@ -35,7 +35,11 @@ func (me *AnnounceEvent) UnmarshalText(text []byte) error {
 	return fmt.Errorf("unknown event")
 }
 
-var announceEventStrings = []string{"", "completed", "started", "stopped"}
+var announceEventStrings = []string{"", "completed", "started", "stopped", "paused"}
+
+// The events defined by BEP 15. Later events, like BEP 21's paused, are sent to UDP trackers as
+// none.
+const numUdpAnnounceEvents = 4
 
 func (e AnnounceEvent) String() string {
 	// See BEP 3, "event", and
@@ -36,6 +36,9 @@ func (cl *Client) Announce(
 	peers AnnounceResponsePeers,
 	err error,
 ) {
+	if req.Event < 0 || req.Event >= numUdpAnnounceEvents {
+		req.Event = 0
+	}
 	respBody, addr, err := cl.request(ctx, ActionAnnounce, append(mustMarshal(req), opts.Encode()...))
 	if err != nil {
 		return
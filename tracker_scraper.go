@@ -203,7 +203,13 @@ func (me *trackerScraper) canIgnoreInterval(notify *<-chan struct{}) bool {
 }
 
 func (me *trackerScraper) Run() {
-	defer me.announceStopped()
+	// Whether the tracker might think we're active, and should be told that we stopped.
+	started := false
+	defer func() {
+		if started {
+			me.announceStopped()
+		}
+	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -219,11 +225,34 @@ func (me *trackerScraper) Run() {
 	e := tracker.Started
 
 	for {
+		select {
+		case <-me.t.networkingEnabled.Off():
+			if started {
+				me.announceStopped()
+				started = false
+			}
+			select {
+			case <-me.t.closed.Done():
+				return
+			case <-me.t.networkingEnabled.On():
+			}
+			e = tracker.Started
+			continue
+		default:
+		}
 		ar := me.announce(ctx, e)
+		started = true
 		// after first announce, get back to regular "none"
 		e = tracker.None
 		me.t.cl.lock()
 		me.lastAnnounce = ar
+		me.t.cl.publishEvent(TrackerAnnounceEvent{
+			Torrent:  me.t,
+			Tracker:  me.u.String(),
+			Err:      ar.Err,
+			NumPeers: ar.NumPeers,
+			Interval: ar.Interval,
+		})
 		me.t.cl.unlock()
 
 	recalculate:
@@ -254,6 +283,7 @@ func (me *trackerScraper) Run() {
 		select {
 		case <-me.t.closed.Done():
 			return
+		case <-me.t.networkingEnabled.Off():
 		case <-reconsider:
 			// Recalculate the interval.
 			goto recalculate
@@ -1,5 +1,150 @@
 package torrent
 
+import (
+	"errors"
+	"slices"
+
+	g "github.com/anacrolix/generics"
+	"github.com/anacrolix/log"
+	"golang.org/x/time/rate"
+
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
 const (
 	v2HashesLogName = "v2hashes"
 )
+
+const (
+	// The most hashes from the base layer we'll send for a hash request.
+	maxHashRequestLength = 512
+	// Limits on the hash requests we'll answer from each peer. Beyond these we send HashReject.
+	hashRequestsPerSecond = 20
+	hashRequestsBurst     = 200
+)
+
+// Handles a BEP 52 hash request from the peer, responding with Hashes or HashReject.
+func (pc *PeerConn) onReadHashRequest(msg pp.Message) error {
+	hr := hashRequestFromMessage(msg)
+	if pc.hashRequestLimiter == nil {
+		pc.hashRequestLimiter = rate.NewLimiter(hashRequestsPerSecond, hashRequestsBurst)
+	}
+	var hashes [][32]byte
+	err := errors.New("too many hash requests")
+	if pc.hashRequestLimiter.Allow() {
+		hashes, err = pc.t.hashRequestHashes(hr)
+	}
+	if err != nil {
+		torrent.Add("hash requests rejected", 1)
+		pc.logger.WithNames(v2HashesLogName).Levelf(log.Debug, "rejecting hash request %v: %v", hr, err)
+		msg.Type = pp.HashReject
+		pc.write(msg)
+		return nil
+	}
+	torrent.Add("hash requests answered", 1)
+	msg.Type = pp.Hashes
+	msg.Hashes = hashes
+	pc.write(msg)
+	return nil
+}
+
+// Handles the peer rejecting one of our hash requests. The request is forgotten so it can be sent
+// again, and other peers are asked for the hashes.
+func (pc *PeerConn) onReadHashReject(msg pp.Message) {
+	hr := hashRequestFromMessage(msg)
+	if !g.MapContains(pc.sentHashRequests, hr) {
+		pc.logger.WithNames(v2HashesLogName).Levelf(log.Debug, "got reject for unsent hash request %v", hr)
+		return
+	}
+	torrent.Add("hash requests rejected by peers", 1)
+	pc.logger.WithNames(v2HashesLogName).Levelf(log.Debug, "hash request %v rejected", hr)
+	delete(pc.sentHashRequests, hr)
+	for other := range pc.t.conns {
+		if other != pc {
+			other.requestMissingHashes()
+		}
+	}
+}
+
+// Returns the hashes for a hash request: the requested hashes from the base layer, followed by the
+// uncle hashes for the proof layers. We only keep the piece layers, so lower base layers can't be
+// answered.
+func (t *Torrent) hashRequestHashes(hr hashRequest) ([][32]byte, error) {
+	if !t.haveInfo() || !t.info.HasV2() {
+		return nil, errors.New("no v2 info")
+	}
+	f := t.getFileByPiecesRoot(hr.piecesRoot)
+	if f == nil {
+		return nil, errors.New("unknown pieces root")
+	}
+	pieceLayer := pp.Integer(merkle.Log2RoundingUp(merkle.RoundUpToPowerOfTwo(
+		uint((t.usualPieceSize() + merkle.BlockSize - 1) / merkle.BlockSize)),
+	))
+	if hr.baseLayer < pieceLayer {
+		return nil, errors.New("base layer below piece layer")
+	}
+	layers, err := t.fileHashTree(f)
+	if err != nil {
+		return nil, err
+	}
+	return hashTreeRequestHashes(
+		layers,
+		int(hr.baseLayer-pieceLayer),
+		int(hr.index),
+		int(hr.length),
+		int(hr.proofLayers))
+}
+
+// Returns the file's hash tree from the piece layer up to the pieces root, building and caching it
+// if necessary.
+func (t *Torrent) fileHashTree(f *File) ([][][32]byte, error) {
+	if layers, ok := t.fileHashTrees[f]; ok {
+		return layers, nil
+	}
+	if f.numPieces() < 2 {
+		return nil, errors.New("file has no piece layer")
+	}
+	pieceHashes := make([][32]byte, 0, f.numPieces())
+	for i := range f.numPieces() {
+		h := t.piece(f.BeginPieceIndex() + i).hashV2
+		if !h.Ok {
+			return nil, errors.New("missing piece hashes")
+		}
+		pieceHashes = append(pieceHashes, h.Value)
+	}
+	layers := merkle.LayersWithPadHash(pieceHashes, metainfo.HashForPiecePad(int64(t.usualPieceSize())))
+	if layers[len(layers)-1][0] != f.piecesRoot.Unwrap() {
+		return nil, errors.New("piece hashes don't match pieces root")
+	}
+	g.MakeMapIfNil(&t.fileHashTrees)
+	t.fileHashTrees[f] = layers
+	return layers, nil
+}
+
+// Returns length hashes from the base layer of the tree starting at index, followed by the uncle
+// hashes for the proof layers above base that can't be computed from them.
+func hashTreeRequestHashes(layers [][][32]byte, base, index, length, proofLayers int) (hashes [][32]byte, err error) {
+	if base < 0 || base >= len(layers)-1 {
+		return nil, errors.New("base layer out of range")
+	}
+	if length < 2 || length > maxHashRequestLength || uint(length) != merkle.RoundUpToPowerOfTwo(uint(length)) {
+		return nil, errors.New("bad length")
+	}
+	if index < 0 || index%length != 0 || index+length > len(layers[base]) {
+		return nil, errors.New("index out of range")
+	}
+	if proofLayers < 0 || proofLayers >= len(layers)-base {
+		return nil, errors.New("too many proof layers")
+	}
+	hashes = slices.Clone(layers[base][index : index+length])
+	// The layers up to the root of the requested hashes can be computed from them.
+	layer := base + int(merkle.Log2RoundingUp(uint(length)))
+	node := index / length
+	for ; layer < base+proofLayers && layer < len(layers)-1; layer++ {
+		hashes = append(hashes, layers[layer][node^1])
+		node /= 2
+	}
+	return
+}
@@ -0,0 +1,126 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/merkle"
+	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// Computes the root from the hashes in a response to a hash request for the base layer.
+func hashRequestResponseRoot(hashes [][32]byte, index, length int) [32]byte {
+	node := merkle.Root(hashes[:length])
+	i := index / length
+	for _, uncle := range hashes[length:] {
+		if i%2 == 0 {
+			node = sha256.Sum256(append(node[:], uncle[:]...))
+		} else {
+			node = sha256.Sum256(append(uncle[:], node[:]...))
+		}
+		i /= 2
+	}
+	return node
+}
+
+func TestHashTreeRequestHashes(t *testing.T) {
+	c := qt.New(t)
+	var base [][32]byte
+	for i := range 5 {
+		base = append(base, sha256.Sum256([]byte{byte(i)}))
+	}
+	layers := merkle.LayersWithPadHash(base, [32]byte{})
+	c.Assert(layers, qt.HasLen, 4)
+	root := merkle.RootWithPadHash(base, [32]byte{})
+	c.Assert(layers[3][0], qt.Equals, root)
+
+	hashes, err := hashTreeRequestHashes(layers, 0, 4, 2, 3)
+	c.Assert(err, qt.IsNil)
+	// 2 hashes, and 2 uncles to get from their parent to the root.
+	c.Assert(hashes, qt.HasLen, 4)
+	c.Check(hashes[:2], qt.DeepEquals, [][32]byte{base[4], {}})
+	c.Check(hashRequestResponseRoot(hashes, 4, 2), qt.Equals, root)
+	// No proof layers.
+	hashes, err = hashTreeRequestHashes(layers, 0, 0, 8, 0)
+	c.Assert(err, qt.IsNil)
+	c.Check(hashes, qt.HasLen, 8)
+	// From a higher layer.
+	hashes, err = hashTreeRequestHashes(layers, 1, 2, 2, 2)
+	c.Assert(err, qt.IsNil)
+	c.Check(hashes, qt.HasLen, 3)
+
+	for _, bad := range [][4]int{
+		{3, 0, 2, 0},  // The root layer.
+		{0, 1, 2, 0},  // Unaligned.
+		{0, 0, 3, 0},  // Not a power of two.
+		{0, 8, 2, 0},  // Past the end.
+		{0, 0, 16, 0}, // Too long.
+		{0, 0, 2, 4},  // More proof layers than the tree has.
+	} {
+		_, err := hashTreeRequestHashes(layers, bad[0], bad[1], bad[2], bad[3])
+		c.Check(err, qt.IsNotNil, qt.Commentf("%v", bad))
+	}
+}
+
+func TestTorrentHashRequestHashes(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	mi, err := metainfo.LoadFromFile("testdata/bittorrent-v2-test.torrent")
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	pieceLayer := pp.Integer(merkle.Log2RoundingUp(uint(tt.usualPieceSize() / merkle.BlockSize)))
+	var f *File
+	for _, f = range tt.Files() {
+		if f.numPieces() > 4 {
+			break
+		}
+	}
+	hr := hashRequest{
+		piecesRoot: f.piecesRoot.Unwrap(),
+		baseLayer:  pieceLayer,
+		index:      2,
+		length:     2,
+		// Up to the root.
+		proofLayers: pp.Integer(merkle.Log2RoundingUp(uint(f.numPieces()))),
+	}
+	hashes, err := tt.hashRequestHashes(hr)
+	c.Assert(err, qt.IsNil)
+	c.Check(hashes[0], qt.Equals, [32]byte(tt.piece(f.BeginPieceIndex()+2).hashV2.Value))
+	c.Check(hashRequestResponseRoot(hashes, 2, 2), qt.Equals, f.piecesRoot.Unwrap())
+	// We don't have the block hashes.
+	hr.baseLayer = 0
+	_, err = tt.hashRequestHashes(hr)
+	c.Check(err, qt.IsNotNil)
+	hr.piecesRoot = [32]byte{}
+	hr.baseLayer = pieceLayer
+	_, err = tt.hashRequestHashes(hr)
+	c.Check(err, qt.IsNotNil)
+}
+
+func TestHashReject(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	mi, err := metainfo.LoadFromFile("testdata/bittorrent-v2-test.torrent")
+	c.Assert(err, qt.IsNil)
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	pc := cl.newConnection(nil, newConnectionOpts{network: "io.Pipe"})
+	pc.setTorrent(tt)
+	hr := hashRequest{piecesRoot: [32]byte{1}, baseLayer: 2, index: 4, length: 2}
+	pc.sentHashRequests = map[hashRequest]struct{}{hr: {}}
+	msg := hr.toMessage()
+	msg.Type = pp.HashReject
+	pc.onReadHashReject(msg)
+	c.Check(pc.sentHashRequests, qt.HasLen, 0)
+	// Rejects for requests we didn't send are ignored.
+	pc.onReadHashReject(msg)
+	c.Check(pc.sentHashRequests, qt.HasLen, 0)
+}
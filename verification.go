@@ -0,0 +1,228 @@
+package torrent
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/RoaringBitmap/roaring"
+	"github.com/anacrolix/chansync"
+	"github.com/anacrolix/chansync/events"
+)
+
+// A check of a Torrent's data against its piece hashes, running in the background. See
+// Torrent.StartVerification.
+type Verification struct {
+	t      *Torrent
+	cancel context.CancelFunc
+	done   chansync.SetOnce
+	// The rest is guarded by the Client lock.
+	started      time.Time
+	finished     time.Time
+	piecesBefore *roaring.Bitmap
+	progress     VerificationProgress
+	piecesGained int
+	piecesLost   int
+	files        map[*File]*VerificationFileResult
+	err          error
+}
+
+type VerificationProgress struct {
+	PiecesChecked int
+	PiecesTotal   int
+	BytesChecked  int64
+	BytesTotal    int64
+	// Bytes checked per second so far.
+	Rate float64
+	// Estimated time remaining, from Rate. Zero if unknown.
+	ETA time.Duration
+}
+
+// The changes to a File's completed pieces found by a Verification.
+type VerificationFileResult struct {
+	File *File
+	// Pieces that weren't complete before, and passed the hash check.
+	PiecesGained int
+	// Pieces that were complete before, and failed the hash check.
+	PiecesLost int
+}
+
+type VerificationReport struct {
+	PiecesChecked int
+	PiecesGained  int
+	PiecesLost    int
+	// The files that gained or lost pieces, in the order of Torrent.Files.
+	Files []VerificationFileResult
+}
+
+// Starts checking all the Torrent's pieces against their hashes in the background, using the
+// Torrent's piece hashers. Piece completion is updated as pieces are checked, like VerifyData.
+// Checking waits for the info if it isn't available yet. Cancelling ctx, or calling Cancel, stops
+// queueing pieces for checking.
+func (t *Torrent) StartVerification(ctx context.Context) *Verification {
+	ctx, cancel := context.WithCancel(ctx)
+	v := &Verification{
+		t:      t,
+		cancel: cancel,
+		files:  make(map[*File]*VerificationFileResult),
+	}
+	go v.run(ctx)
+	return v
+}
+
+// Stops the Verification. Pieces already being checked are still updated.
+func (v *Verification) Cancel() {
+	v.cancel()
+}
+
+// Closed when the Verification has finished or stopped.
+func (v *Verification) Done() events.Done {
+	return v.done.Done()
+}
+
+func (v *Verification) Progress() VerificationProgress {
+	v.t.cl.rLock()
+	defer v.t.cl.rUnlock()
+	ret := v.progress
+	if v.started.IsZero() {
+		return ret
+	}
+	end := v.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	elapsed := end.Sub(v.started)
+	if elapsed > 0 {
+		ret.Rate = float64(ret.BytesChecked) / elapsed.Seconds()
+	}
+	if ret.Rate > 0 && v.finished.IsZero() {
+		ret.ETA = time.Duration(float64(ret.BytesTotal-ret.BytesChecked) / ret.Rate * float64(time.Second))
+	}
+	return ret
+}
+
+// Waits for the Verification to finish, and returns what it found. The error is set if it didn't
+// check every piece, but the report still covers the pieces that were checked.
+func (v *Verification) Wait() (VerificationReport, error) {
+	<-v.Done()
+	cl := v.t.cl
+	cl.rLock()
+	defer cl.rUnlock()
+	report := VerificationReport{
+		PiecesChecked: v.progress.PiecesChecked,
+		PiecesGained:  v.piecesGained,
+		PiecesLost:    v.piecesLost,
+	}
+	for _, f := range v.files {
+		report.Files = append(report.Files, *f)
+	}
+	slices.SortFunc(report.Files, func(a, b VerificationFileResult) int {
+		return cmp.Compare(a.File.Offset(), b.File.Offset())
+	})
+	return report, v.err
+}
+
+func (v *Verification) run(ctx context.Context) {
+	t := v.t
+	defer v.done.Set()
+	select {
+	case <-t.GotInfo():
+	case <-t.closed.Done():
+	case <-ctx.Done():
+	}
+	cl := t.cl
+	cl.lock()
+	defer cl.unlock()
+	// Wake the loop below when cancelled.
+	defer context.AfterFunc(ctx, func() {
+		cl.lock()
+		cl.event.Broadcast()
+		cl.unlock()
+	})()
+	v.started = time.Now()
+	defer func() {
+		v.finished = time.Now()
+	}()
+	if t.haveInfo() {
+		v.progress.PiecesTotal = t.numPieces()
+		v.progress.BytesTotal = t.length()
+		v.piecesBefore = t._completedPieces.Clone()
+	}
+	type checking struct {
+		piece  pieceIndex
+		target int64
+	}
+	var pending []checking
+	next := 0
+	for {
+		pending = slices.DeleteFunc(pending, func(c checking) bool {
+			p := t.piece(c.piece)
+			// The completion is updated after the verify count, while marking.
+			if p.numVerifies < c.target || p.marking {
+				return false
+			}
+			v.pieceChecked(c.piece)
+			return true
+		})
+		if t.closed.IsSet() {
+			v.err = errors.New("torrent closed")
+			return
+		}
+		if ctx.Err() != nil {
+			v.err = ctx.Err()
+			return
+		}
+		// Keep enough pieces queued for the hashers to stay busy.
+		for next < v.progress.PiecesTotal && len(pending) < 2*t.cl.config.PieceHashersPerTorrent {
+			p := t.piece(next)
+			if p.hash == nil && !p.hashV2.Ok {
+				// The piece can't be checked until we have its hash.
+				v.err = errors.New("piece hashes not available")
+				next++
+				continue
+			}
+			c := checking{next, p.numVerifies + 1}
+			if p.hashing {
+				// The current hash might have started before the data changed.
+				c.target++
+			}
+			t.queuePieceCheck(next)
+			pending = append(pending, c)
+			next++
+		}
+		if len(pending) == 0 {
+			return
+		}
+		cl.event.Wait()
+	}
+}
+
+func (v *Verification) pieceChecked(i pieceIndex) {
+	t := v.t
+	v.progress.PiecesChecked++
+	v.progress.BytesChecked += int64(t.pieceLength(i))
+	before := v.piecesBefore.Contains(uint32(i))
+	after := t.pieceComplete(i)
+	if before == after {
+		return
+	}
+	if after {
+		v.piecesGained++
+	} else {
+		v.piecesLost++
+	}
+	for _, f := range t.piece(i).files {
+		r := v.files[f]
+		if r == nil {
+			r = &VerificationFileResult{File: f}
+			v.files[f] = r
+		}
+		if after {
+			r.PiecesGained++
+		} else {
+			r.PiecesLost++
+		}
+	}
+}
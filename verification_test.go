@@ -0,0 +1,54 @@
+package torrent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestVerification(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+
+	v := tt.StartVerification(context.Background())
+	report, err := v.Wait()
+	c.Assert(err, qt.IsNil)
+	c.Check(report.PiecesChecked, qt.Equals, tt.NumPieces())
+	c.Check(tt.Complete.Bool(), qt.IsTrue)
+	progress := v.Progress()
+	c.Check(progress.BytesChecked, qt.Equals, tt.Length())
+	c.Check(progress.ETA, qt.Equals, time.Duration(0))
+
+	c.Assert(os.WriteFile(filepath.Join(dir, testutil.GreetingFileName), []byte("goodbye"), 0o666), qt.IsNil)
+	report, err = tt.StartVerification(context.Background()).Wait()
+	c.Assert(err, qt.IsNil)
+	c.Check(report.PiecesLost, qt.Equals, tt.NumPieces())
+	c.Check(report.PiecesGained, qt.Equals, 0)
+	c.Assert(report.Files, qt.HasLen, 1)
+	c.Check(report.Files[0].File, qt.Equals, tt.Files()[0])
+	c.Check(report.Files[0].PiecesLost, qt.Equals, tt.NumPieces())
+	c.Check(tt.Complete.Bool(), qt.IsFalse)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tt.StartVerification(ctx).Wait()
+	c.Check(err, qt.ErrorIs, context.Canceled)
+}